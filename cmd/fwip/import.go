@@ -0,0 +1,124 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/djcrock/fwip/internal/imdb"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// runImport handles the `import` subcommand, which loads titles from external datasets.
+func runImport(repoPool *repository.Pool, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fwip import imdb [flags]")
+	}
+	switch args[0] {
+	case "imdb":
+		return runImportImdb(repoPool, args[1:])
+	default:
+		return fmt.Errorf("unknown import source `%s`", args[0])
+	}
+}
+
+// runImportImdb upserts titles from local copies of the IMDb non-commercial datasets.
+// Titles are keyed on their IMDb ID, so running the import again updates titles in place.
+func runImportImdb(repoPool *repository.Pool, args []string) (err error) {
+	flags := flag.NewFlagSet("import imdb", flag.ExitOnError)
+	basicsPath := flags.String("basics", "title.basics.tsv.gz", "path to the IMDb title.basics dataset")
+	ratingsPath := flags.String("ratings", "", "optional path to the IMDb title.ratings dataset")
+	batchSize := flags.Int("batch", 1000, "number of titles to write per transaction")
+	includeAdult := flags.Bool("adult", false, "import titles flagged as adult")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	if *batchSize < 1 {
+		return errors.New("batch size must be positive")
+	}
+
+	var ratings map[string]imdb.Rating
+	if *ratingsPath != "" {
+		log.Printf("reading ratings from %s", *ratingsPath)
+		ratings, err = readDataset(*ratingsPath, imdb.ReadRatings)
+		if err != nil {
+			return fmt.Errorf("failed to read ratings: %w", err)
+		}
+		log.Printf("read %d ratings", len(ratings))
+	}
+
+	repo := repoPool.GetRepository(context.Background())
+	defer repoPool.PutRepository(repo)
+
+	log.Printf("importing titles from %s", *basicsPath)
+	imported := 0
+	batch := make([]*model.Title, 0, *batchSize)
+	flush := func() (err error) {
+		if len(batch) == 0 {
+			return
+		}
+		defer repo.Transact()(&err)
+		for _, title := range batch {
+			err = repo.ImportTitle(title, ratings != nil)
+			if err != nil {
+				return
+			}
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		log.Printf("imported %d titles", imported)
+		return
+	}
+
+	_, err = readDataset(*basicsPath, func(r io.Reader) (struct{}, error) {
+		return struct{}{}, imdb.ReadBasics(r, *includeAdult, func(title *model.Title) error {
+			if rating, ok := ratings[title.ImdbId]; ok {
+				title.ImdbRating = rating.AverageRating
+				title.ImdbVotes = rating.NumVotes
+			}
+			batch = append(batch, title)
+			if len(batch) < *batchSize {
+				return nil
+			}
+			return flush()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import titles: %w", err)
+	}
+	err = flush()
+	if err != nil {
+		return fmt.Errorf("failed to import titles: %w", err)
+	}
+
+	log.Printf("finished importing %d titles", imported)
+	return nil
+}
+
+// readDataset opens the file at path, transparently decompressing it if it is gzipped.
+func readDataset[T any](path string, read func(io.Reader) (T, error)) (result T, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(file)
+		if err != nil {
+			return
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return read(r)
+}
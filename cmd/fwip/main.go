@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/djcrock/fwip/internal/repository"
 	"github.com/djcrock/fwip/internal/web"
 	"log"
@@ -66,6 +67,22 @@ func main() {
 	defer dbPool.Close()
 
 	repoPool := repository.NewPool(dbPool)
+
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "import":
+			err = runImport(repoPool, flag.Args()[1:])
+		case "user":
+			err = runUser(repoPool, flag.Args()[1:])
+		default:
+			err = fmt.Errorf("unknown command `%s`", flag.Arg(0))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	app := web.NewApp(log.Default(), repoPool)
 
 	srv := &http.Server{
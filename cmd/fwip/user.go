@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/auth"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"log"
+	"os"
+	"strings"
+)
+
+// runUser handles the `user` subcommand, which manages user accounts.
+func runUser(repoPool *repository.Pool, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fwip user passwd|role ...")
+	}
+	switch args[0] {
+	case "passwd":
+		return runUserPasswd(repoPool, args[1:])
+	case "role":
+		return runUserRole(repoPool, args[1:])
+	default:
+		return fmt.Errorf("unknown user command `%s`", args[0])
+	}
+}
+
+// runUserPasswd sets a user's password, reading the new password from the first line of standard input.
+// This is how users created before passwords existed get one.
+func runUserPasswd(repoPool *repository.Pool, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: fwip user passwd <username>")
+	}
+	username := args[0]
+
+	log.Printf("enter a new password for %s:", username)
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) < auth.MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength)
+	}
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	repo := repoPool.GetRepository(context.Background())
+	defer repoPool.PutRepository(repo)
+
+	user, err := repo.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	err = repo.SetUserPassword(user.Id, passwordHash)
+	if err != nil {
+		return err
+	}
+	log.Printf("password set for %s", username)
+	return nil
+}
+
+// runUserRole sets a user's role. This is how the first admin is created.
+func runUserRole(repoPool *repository.Pool, args []string) error {
+	if len(args) != 2 || !model.IsValidRole(args[1]) {
+		return errors.New("usage: fwip user role <username> admin|member")
+	}
+	username, role := args[0], args[1]
+
+	repo := repoPool.GetRepository(context.Background())
+	defer repoPool.PutRepository(repo)
+
+	user, err := repo.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	_, err = repo.PutUser(user)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s now has the %s role", username, role)
+	return nil
+}
@@ -1,8 +1,11 @@
 module github.com/djcrock/fwip
 
-go 1.22.1
+go 1.24
 
-require zombiezen.com/go/sqlite v1.1.2
+require (
+	golang.org/x/crypto v0.24.0
+	zombiezen.com/go/sqlite v1.1.2
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -10,7 +13,7 @@ require (
 	github.com/mattn/go-isatty v0.0.16 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 	modernc.org/libc v1.41.0 // indirect
 	modernc.org/mathutil v1.6.0 // indirect
 	modernc.org/memory v1.7.2 // indirect
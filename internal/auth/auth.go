@@ -0,0 +1,109 @@
+// Package auth hashes passwords and generates the random tokens used for sessions and share links.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"math/big"
+	"strings"
+)
+
+// MinPasswordLength is the shortest password a user may choose.
+const MinPasswordLength = 8
+
+// Parameters for argon2id, following the second recommended option in RFC 9106.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	saltLen      = 16
+)
+
+// tokenLen is the number of random bytes in a token.
+const tokenLen = 32
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// HashPassword hashes a password with argon2id, returning the hash in the PHC string format.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		argonMemory,
+		argonTime,
+		argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword reports whether password matches a hash produced by HashPassword.
+// The parameters are read from the hash, so hashes made with older parameters keep working.
+func CheckPassword(hash string, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+// NewToken generates a random token suitable for use as a session identifier.
+func NewToken() (string, error) {
+	token := make([]byte, tokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// HashToken hashes a token for storage. Tokens are long and random, so a fast hash is enough to keep a
+// leaked database from being usable to impersonate anyone.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// shareTokenLen is the number of random bytes in a share token.
+const shareTokenLen = 16
+
+// NewShareToken generates a random token for a public share link. Share tokens only grant read access, so
+// they are shorter than session tokens, and are encoded in lowercase base36 like identifiers so that they
+// make tidy URLs.
+func NewShareToken() (string, error) {
+	token := make([]byte, shareTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return new(big.Int).SetBytes(token).Text(36), nil
+}
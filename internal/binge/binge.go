@@ -0,0 +1,167 @@
+// Package binge plans when to watch the rest of a series, given how long a user has to watch each day.
+package binge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Plans are cut off rather than scheduling episodes more than this many days out.
+const maxDays = 10 * 366
+
+var (
+	ErrNoTime         = errors.New("budget doesn't leave any time to watch")
+	ErrUnknownRuntime = errors.New("episode runtimes aren't known")
+	ErrTooLong        = errors.New("plan would take more than ten years")
+)
+
+// A Budget is how many minutes the user has to watch on each day of the week, indexed by time.Weekday.
+type Budget [7]int64
+
+var dayNames = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// ParseBudget reads a budget like `weekdays:90,weekends:3h`. Each comma-separated entry gives the time
+// for `daily`, `weekdays`, `weekends`, a day like `mon` or a range of days like `mon-thu`, with later
+// entries overriding earlier ones. Times are either minutes or durations like `1h30m`, and an entry
+// without any days applies to every day.
+func ParseBudget(s string) (Budget, error) {
+	var budget Budget
+	if strings.TrimSpace(s) == "" {
+		return budget, errors.New("missing budget")
+	}
+	for _, entry := range strings.Split(s, ",") {
+		days, amount, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			days, amount = "daily", days
+		}
+		weekdays, err := parseDays(strings.ToLower(strings.TrimSpace(days)))
+		if err != nil {
+			return budget, err
+		}
+		minutes, err := parseMinutes(strings.TrimSpace(amount))
+		if err != nil {
+			return budget, err
+		}
+		for _, weekday := range weekdays {
+			budget[weekday] = minutes
+		}
+	}
+	return budget, nil
+}
+
+func parseDays(days string) ([]time.Weekday, error) {
+	switch days {
+	case "daily":
+		return []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}, nil
+	case "weekdays":
+		return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, nil
+	case "weekends":
+		return []time.Weekday{time.Saturday, time.Sunday}, nil
+	}
+	from, to, isRange := strings.Cut(days, "-")
+	first, err := parseDay(from)
+	if err != nil {
+		return nil, err
+	}
+	if !isRange {
+		return []time.Weekday{first}, nil
+	}
+	last, err := parseDay(to)
+	if err != nil {
+		return nil, err
+	}
+	// Ranges may wrap around the end of the week, like `fri-mon`.
+	weekdays := []time.Weekday{first}
+	for day := first; day != last; {
+		day = (day + 1) % 7
+		weekdays = append(weekdays, day)
+	}
+	return weekdays, nil
+}
+
+// parseDay reads the name of a day of the week, which may be shortened to its first three letters or more.
+func parseDay(name string) (time.Weekday, error) {
+	if len(name) >= 3 {
+		for i, dayName := range dayNames {
+			if strings.HasPrefix(dayName, name) {
+				return time.Weekday(i), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown days `%s`", name)
+}
+
+func parseMinutes(amount string) (int64, error) {
+	minutes, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		duration, durationErr := time.ParseDuration(amount)
+		if durationErr != nil {
+			return 0, fmt.Errorf("time must be minutes or a duration like `1h30m`, not `%s`", amount)
+		}
+		minutes = int64(duration / time.Minute)
+	}
+	if minutes < 0 || minutes > 24*60 {
+		return 0, errors.New("time must be between 0 and 24 hours a day")
+	}
+	return minutes, nil
+}
+
+// Schedule spreads the episodes over the days from start, in order, fitting as many into each day as the
+// budget allows. Episodes whose runtime isn't known are counted as lasting averageRuntime, and episodes
+// aren't scheduled before they air. An episode longer than any day's budget gets one of the longest days
+// to itself. Days without anything to watch are left out.
+func Schedule(episodes []*model.Episode, averageRuntime int64, budget Budget, start time.Time) ([]*model.BingeDay, error) {
+	days := make([]*model.BingeDay, 0)
+	if len(episodes) == 0 {
+		return days, nil
+	}
+	var longestDay int64
+	for _, minutes := range budget {
+		longestDay = max(longestDay, minutes)
+	}
+	if longestDay == 0 {
+		return nil, ErrNoTime
+	}
+	runtimes := make([]int64, len(episodes))
+	for i, episode := range episodes {
+		runtimes[i] = episode.Runtime
+		if runtimes[i] == 0 {
+			runtimes[i] = averageRuntime
+		}
+		if runtimes[i] == 0 {
+			return nil, ErrUnknownRuntime
+		}
+	}
+
+	next := 0
+	date := start
+	for n := 0; next < len(episodes); n++ {
+		if n == maxDays {
+			return nil, ErrTooLong
+		}
+		dateStr := date.Format(time.DateOnly)
+		minutes := budget[date.Weekday()]
+		var day *model.BingeDay
+		var used int64
+		for next < len(episodes) {
+			episode := episodes[next]
+			if episode.AirDate > dateStr || used+min(runtimes[next], longestDay) > minutes {
+				break
+			}
+			if day == nil {
+				day = &model.BingeDay{Date: dateStr}
+				days = append(days, day)
+			}
+			day.Episodes = append(day.Episodes, episode)
+			day.Minutes += runtimes[next]
+			used += min(runtimes[next], longestDay)
+			next++
+		}
+		date = date.AddDate(0, 0, 1)
+	}
+	return days, nil
+}
@@ -0,0 +1,212 @@
+package binge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		budget string
+		want   Budget
+	}{
+		// Budgets are indexed from Sunday.
+		{"90", Budget{90, 90, 90, 90, 90, 90, 90}},
+		{"daily:1h30m", Budget{90, 90, 90, 90, 90, 90, 90}},
+		{"weekdays:90,weekends:3h", Budget{180, 90, 90, 90, 90, 90, 180}},
+		{"daily:30, wed:0", Budget{30, 30, 30, 0, 30, 30, 30}},
+		{"Thurs:45", Budget{0, 0, 0, 0, 45, 0, 0}},
+		{"mon-wed:60", Budget{0, 60, 60, 60, 0, 0, 0}},
+		{"fri-mon:60", Budget{60, 60, 0, 0, 0, 60, 60}},
+		{"sat-sun:120", Budget{120, 0, 0, 0, 0, 0, 120}},
+		{"sun-sun:10", Budget{10, 0, 0, 0, 0, 0, 0}},
+		{"weekends:24h", Budget{1440, 0, 0, 0, 0, 0, 1440}},
+	}
+	for _, test := range tests {
+		got, err := ParseBudget(test.budget)
+		if err != nil {
+			t.Errorf("ParseBudget(%q) returned error: %v", test.budget, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseBudget(%q) = %v, want %v", test.budget, got, test.want)
+		}
+	}
+}
+
+func TestParseBudgetErrors(t *testing.T) {
+	tests := []string{
+		"",
+		" ",
+		"mo:30",
+		"someday:30",
+		"mon-xyz:30",
+		"mon:soon",
+		"mon:-5",
+		"mon:25h",
+		"90,",
+	}
+	for _, budget := range tests {
+		if got, err := ParseBudget(budget); err == nil {
+			t.Errorf("ParseBudget(%q) = %v, want an error", budget, got)
+		}
+	}
+}
+
+// 2024-01-05 is a Friday.
+var scheduleStart = time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		name           string
+		episodes       []*model.Episode
+		averageRuntime int64
+		budget         Budget
+		// want lists each day as its date, the minutes watched and the numbers of its episodes.
+		want []string
+	}{
+		{
+			name:   "no episodes",
+			budget: Budget{60, 60, 60, 60, 60, 60, 60},
+			want:   []string{},
+		},
+		{
+			name:     "fills each day",
+			episodes: episodes(30, 30, 30, 30, 30),
+			budget:   Budget{60, 60, 60, 60, 60, 60, 60},
+			want:     []string{"2024-01-05 60 [1 2]", "2024-01-06 60 [3 4]", "2024-01-07 30 [5]"},
+		},
+		{
+			name:     "skips days without time",
+			episodes: episodes(45, 45, 45),
+			budget:   Budget{0, 45, 0, 0, 0, 0, 90},
+			want:     []string{"2024-01-06 90 [1 2]", "2024-01-08 45 [3]"},
+		},
+		{
+			name:           "unknown runtimes count as the average",
+			episodes:       episodes(0, 20, 0),
+			averageRuntime: 40,
+			budget:         Budget{60, 60, 60, 60, 60, 60, 60},
+			want:           []string{"2024-01-05 60 [1 2]", "2024-01-06 40 [3]"},
+		},
+		{
+			name:     "episode longer than any day gets a longest day to itself",
+			episodes: episodes(30, 150, 30),
+			budget:   Budget{60, 60, 60, 60, 60, 60, 120},
+			want:     []string{"2024-01-05 30 [1]", "2024-01-06 150 [2]", "2024-01-07 30 [3]"},
+		},
+		{
+			name:     "episode longer than any day waits for an empty day",
+			episodes: episodes(60, 150),
+			budget:   Budget{120, 120, 120, 120, 120, 120, 120},
+			want:     []string{"2024-01-05 60 [1]", "2024-01-06 150 [2]"},
+		},
+		{
+			name: "episodes aren't scheduled before they air",
+			episodes: []*model.Episode{
+				{Number: 1, Runtime: 30},
+				{Number: 2, Runtime: 30, AirDate: "2024-01-05"},
+				{Number: 3, Runtime: 30, AirDate: "2024-01-08"},
+				{Number: 4, Runtime: 30, AirDate: "2024-01-08"},
+			},
+			budget: Budget{120, 120, 120, 120, 120, 120, 120},
+			want:   []string{"2024-01-05 60 [1 2]", "2024-01-08 60 [3 4]"},
+		},
+		{
+			name: "later episodes wait for earlier ones to air",
+			episodes: []*model.Episode{
+				{Number: 1, Runtime: 30, AirDate: "2024-01-07"},
+				{Number: 2, Runtime: 30, AirDate: "2023-12-01"},
+			},
+			budget: Budget{120, 120, 120, 120, 120, 120, 120},
+			want:   []string{"2024-01-07 60 [1 2]"},
+		},
+		{
+			name: "episodes airing just within ten years",
+			episodes: []*model.Episode{
+				{Number: 1, Runtime: 30, AirDate: scheduleStart.AddDate(0, 0, maxDays-1).Format(time.DateOnly)},
+			},
+			budget: Budget{60, 60, 60, 60, 60, 60, 60},
+			want:   []string{"2034-01-11 30 [1]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			days, err := Schedule(test.episodes, test.averageRuntime, test.budget, scheduleStart)
+			if err != nil {
+				t.Fatalf("Schedule returned error: %v", err)
+			}
+			got := make([]string, len(days))
+			for i, day := range days {
+				numbers := make([]int64, len(day.Episodes))
+				for j, episode := range day.Episodes {
+					numbers[j] = episode.Number
+				}
+				got[i] = fmt.Sprintf("%s %d %v", day.Date, day.Minutes, numbers)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Schedule = %s, want %s", strings.Join(got, ", "), strings.Join(test.want, ", "))
+			}
+		})
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		episodes       []*model.Episode
+		averageRuntime int64
+		budget         Budget
+		want           error
+	}{
+		{
+			name:     "no time",
+			episodes: episodes(30),
+			want:     ErrNoTime,
+		},
+		{
+			name:     "unknown runtime",
+			episodes: episodes(30, 0),
+			budget:   Budget{60, 60, 60, 60, 60, 60, 60},
+			want:     ErrUnknownRuntime,
+		},
+		{
+			name: "airs after ten years",
+			episodes: []*model.Episode{
+				{Number: 1, Runtime: 30, AirDate: scheduleStart.AddDate(0, 0, maxDays).Format(time.DateOnly)},
+			},
+			budget: Budget{60, 60, 60, 60, 60, 60, 60},
+			want:   ErrTooLong,
+		},
+		{
+			name:     "too many episodes for ten years",
+			episodes: episodes(make([]int64, maxDays+1)...),
+			// Every episode takes a whole Sunday.
+			averageRuntime: 30,
+			budget:         Budget{30, 0, 0, 0, 0, 0, 0},
+			want:           ErrTooLong,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			days, err := Schedule(test.episodes, test.averageRuntime, test.budget, scheduleStart)
+			if !errors.Is(err, test.want) {
+				t.Errorf("Schedule = %v, %v, want error %v", days, err, test.want)
+			}
+		})
+	}
+}
+
+// episodes makes episodes numbered from 1 with the given runtimes, which have already aired.
+func episodes(runtimes ...int64) []*model.Episode {
+	episodes := make([]*model.Episode, len(runtimes))
+	for i, runtime := range runtimes {
+		episodes[i] = &model.Episode{Number: int64(i + 1), Runtime: runtime}
+	}
+	return episodes
+}
@@ -0,0 +1,84 @@
+package binge
+
+import (
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Lines longer than this many bytes are folded onto continuation lines, as RFC 5545 requires.
+const maxLineLength = 75
+
+// textEscaper escapes text values. Line breaks of any kind become `\n`, since a bare CR would end the line.
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+
+// WriteICalendar writes the plan as an iCalendar file with an all-day event for each day of it.
+func WriteICalendar(w io.Writer, plan *model.BingePlan, now time.Time) error {
+	var b strings.Builder
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:-//fwip//binge plan//EN")
+	writeLine(&b, "CALSCALE:GREGORIAN")
+	writeLine(&b, "X-WR-CALNAME:"+escapeText(plan.Title.Name))
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, day := range plan.Days {
+		date, err := time.Parse(time.DateOnly, day.Date)
+		if err != nil {
+			return err
+		}
+		descriptions := make([]string, len(day.Episodes))
+		for i, episode := range day.Episodes {
+			descriptions[i] = fmt.Sprintf("%s %s", episodeCode(episode), episode.Name)
+			if episode.Runtime > 0 {
+				descriptions[i] += fmt.Sprintf(" (%d min)", episode.Runtime)
+			}
+		}
+		summary := plan.Title.Name + ": " + episodeCode(day.Episodes[0])
+		if len(day.Episodes) > 1 {
+			summary += "–" + episodeCode(day.Episodes[len(day.Episodes)-1])
+		}
+
+		writeLine(&b, "BEGIN:VEVENT")
+		writeLine(&b, "UID:"+day.Date+"-"+plan.Title.Id.String()+"@fwip")
+		writeLine(&b, "DTSTAMP:"+stamp)
+		writeLine(&b, "DTSTART;VALUE=DATE:"+date.Format("20060102"))
+		writeLine(&b, "DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format("20060102"))
+		writeLine(&b, "SUMMARY:"+escapeText(summary))
+		writeLine(&b, "DESCRIPTION:"+escapeText(strings.Join(descriptions, "\n")))
+		writeLine(&b, "TRANSP:TRANSPARENT")
+		writeLine(&b, "END:VEVENT")
+	}
+	writeLine(&b, "END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// episodeCode identifies an episode like `S1E02`.
+func episodeCode(episode *model.Episode) string {
+	return fmt.Sprintf("S%dE%02d", episode.SeasonNumber, episode.Number)
+}
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// writeLine writes a content line, folding it without splitting any UTF-8 characters.
+func writeLine(b *strings.Builder, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length.
+		limit = maxLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
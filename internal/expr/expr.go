@@ -0,0 +1,290 @@
+// Package expr parses the filter mini-language used to narrow lists of titles, like
+//
+//	type:movie year:>=1990 runtime:<110 service:netflix,max -watched:me
+//
+// A filter is a list of terms separated by spaces, all of which must match. Each term is either a word to
+// search title names for, or a field and value separated by a colon. Numeric fields may be compared with
+// `<`, `<=`, `>` or `>=` placed after the colon, and other fields accept several values separated by commas,
+// any of which may match. A term preceded by `-` matches titles that don't match the term. Values containing
+// spaces or commas can be quoted with double quotes.
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	FieldType    = "type"
+	FieldYear    = "year"
+	FieldRuntime = "runtime"
+	FieldRating  = "rating"
+	FieldService = "service"
+	FieldGenre   = "genre"
+	// FieldWatched matches titles the named user has watched.
+	FieldWatched = "watched"
+	// FieldWants matches titles the named user wants to watch.
+	FieldWants = "wants"
+)
+
+// Me stands for the user making a request wherever a username is expected.
+const Me = "me"
+
+type Op string
+
+const (
+	OpEq Op = ""
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+)
+
+// A Node is a term of a parsed filter.
+type Node interface {
+	node()
+}
+
+// And matches titles matching all of its terms.
+type And struct {
+	Terms []Node
+}
+
+// Not matches titles that don't match its term.
+type Not struct {
+	Term Node
+}
+
+// Compare matches titles whose numeric field compares to the value with the operator.
+type Compare struct {
+	Field string
+	Op    Op
+	Value float64
+}
+
+// OneOf matches titles whose field has any of the values.
+type OneOf struct {
+	Field  string
+	Values []string
+}
+
+// UserHas matches titles the user has watched or wants to watch, depending on the field.
+type UserHas struct {
+	Field    string
+	Username string
+}
+
+// Text matches titles with names containing words starting with each of the words.
+type Text struct {
+	Words []string
+}
+
+func (*And) node()     {}
+func (*Not) node()     {}
+func (*Compare) node() {}
+func (*OneOf) node()   {}
+func (*UserHas) node() {}
+func (*Text) node()    {}
+
+// A SyntaxError reports the first term of a filter that couldn't be parsed.
+type SyntaxError struct {
+	// Pos is the byte offset of the term in the filter.
+	Pos     int
+	Token   string
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d: `%s`", e.Message, e.Pos+1, e.Token)
+}
+
+// Walk calls fn for the node and each of the nodes beneath it.
+func Walk(n Node, fn func(Node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *And:
+		for _, term := range n.Terms {
+			Walk(term, fn)
+		}
+	case *Not:
+		Walk(n.Term, fn)
+	}
+}
+
+// Parse parses a filter. It returns nil if the filter has no terms, and a *SyntaxError if it is malformed.
+func Parse(filter string) (Node, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	and := &And{}
+	var text *Text
+	for _, tok := range tokens {
+		term, err := parseTerm(tok)
+		if err != nil {
+			return nil, err
+		}
+		// Gather the words to search for into a single term.
+		if t, ok := term.(*Text); ok {
+			if text == nil {
+				text = t
+				and.Terms = append(and.Terms, text)
+			} else {
+				text.Words = append(text.Words, t.Words...)
+			}
+			continue
+		}
+		and.Terms = append(and.Terms, term)
+	}
+	return and, nil
+}
+
+// A token is a term of a filter, before it is parsed.
+type token struct {
+	pos int
+	raw string
+	// negated is set if the term starts with `-`, which is not included in field.
+	negated bool
+	// field is empty if the term has no colon.
+	field string
+	// values are the comma-separated values following the colon, or the whole term if it has no colon,
+	// with any quotes removed.
+	values []string
+}
+
+// tokenize splits a filter into terms.
+func tokenize(filter string) ([]*token, error) {
+	var tokens []*token
+	i := 0
+	for {
+		for i < len(filter) && filter[i] == ' ' {
+			i++
+		}
+		if i == len(filter) {
+			return tokens, nil
+		}
+
+		tok := &token{pos: i}
+		start := i
+		if filter[i] == '-' {
+			tok.negated = true
+			i++
+		}
+		var value strings.Builder
+		for i < len(filter) && filter[i] != ' ' {
+			switch c := filter[i]; {
+			case c == '"':
+				end := strings.IndexByte(filter[i+1:], '"')
+				if end < 0 {
+					return nil, &SyntaxError{Pos: start, Token: filter[start:], Message: "unterminated quote"}
+				}
+				value.WriteString(filter[i+1 : i+1+end])
+				i += end + 2
+			case c == ':' && tok.field == "":
+				tok.field = value.String()
+				if tok.field == "" {
+					return nil, &SyntaxError{Pos: start, Token: termAt(filter, start), Message: "missing field name"}
+				}
+				value.Reset()
+				i++
+			case c == ',' && tok.field != "":
+				tok.values = append(tok.values, value.String())
+				value.Reset()
+				i++
+			default:
+				value.WriteByte(c)
+				i++
+			}
+		}
+		tok.raw = filter[start:i]
+		tok.values = append(tok.values, value.String())
+		tokens = append(tokens, tok)
+	}
+}
+
+// termAt returns the term starting at the given position, for reporting errors.
+func termAt(filter string, pos int) string {
+	if end := strings.IndexByte(filter[pos:], ' '); end >= 0 {
+		return filter[pos : pos+end]
+	}
+	return filter[pos:]
+}
+
+func parseTerm(tok *token) (Node, error) {
+	fail := func(format string, args ...any) error {
+		return &SyntaxError{Pos: tok.pos, Token: tok.raw, Message: fmt.Sprintf(format, args...)}
+	}
+
+	var term Node
+	switch tok.field {
+	case "":
+		if strings.TrimSpace(tok.values[0]) == "" {
+			return nil, fail("missing search word")
+		}
+		if tok.negated {
+			return nil, fail("search words can't be negated")
+		}
+		return &Text{Words: tok.values}, nil
+	case FieldYear, FieldRuntime, FieldRating:
+		if len(tok.values) > 1 {
+			return nil, fail("%s takes a single value", tok.field)
+		}
+		op, valueStr := parseOp(tok.values[0])
+		var value float64
+		var err error
+		if tok.field == FieldRating {
+			value, err = strconv.ParseFloat(valueStr, 64)
+			if err != nil || value < 0 || value > 10 {
+				return nil, fail("rating must be a number between 0 and 10")
+			}
+		} else {
+			var n int64
+			n, err = strconv.ParseInt(valueStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fail("%s must be a whole number", tok.field)
+			}
+			value = float64(n)
+		}
+		term = &Compare{Field: tok.field, Op: op, Value: value}
+	case FieldType, FieldService, FieldGenre:
+		for _, value := range tok.values {
+			if value == "" {
+				return nil, fail("missing %s", tok.field)
+			}
+			if op, _ := parseOp(value); op != OpEq {
+				return nil, fail("%s can't be compared with `%s`", tok.field, op)
+			}
+			if tok.field == FieldType && value != "movie" && value != "series" {
+				return nil, fail("type must be `movie` or `series`")
+			}
+		}
+		term = &OneOf{Field: tok.field, Values: tok.values}
+	case FieldWatched, FieldWants:
+		if len(tok.values) > 1 || tok.values[0] == "" {
+			return nil, fail("%s takes a single username, or `me`", tok.field)
+		}
+		term = &UserHas{Field: tok.field, Username: tok.values[0]}
+	default:
+		return nil, fail("unknown field `%s`", tok.field)
+	}
+
+	if tok.negated {
+		term = &Not{Term: term}
+	}
+	return term, nil
+}
+
+// parseOp splits a comparison operator from the start of a value.
+func parseOp(value string) (Op, string) {
+	for _, op := range []Op{OpLe, OpGe, OpLt, OpGt} {
+		if rest, ok := strings.CutPrefix(value, string(op)); ok {
+			return op, rest
+		}
+	}
+	return OpEq, value
+}
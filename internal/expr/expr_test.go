@@ -0,0 +1,87 @@
+package expr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Node
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"type:movie", &And{Terms: []Node{&OneOf{Field: FieldType, Values: []string{"movie"}}}}},
+		{"service:netflix,max", &And{Terms: []Node{&OneOf{Field: FieldService, Values: []string{"netflix", "max"}}}}},
+		{`genre:"science fiction",drama`, &And{Terms: []Node{
+			&OneOf{Field: FieldGenre, Values: []string{"science fiction", "drama"}},
+		}}},
+		{`service:"a,b"`, &And{Terms: []Node{&OneOf{Field: FieldService, Values: []string{"a,b"}}}}},
+		{"year:1990", &And{Terms: []Node{&Compare{Field: FieldYear, Op: OpEq, Value: 1990}}}},
+		{"year:<1990", &And{Terms: []Node{&Compare{Field: FieldYear, Op: OpLt, Value: 1990}}}},
+		{"year:<=1990", &And{Terms: []Node{&Compare{Field: FieldYear, Op: OpLe, Value: 1990}}}},
+		{"runtime:>90", &And{Terms: []Node{&Compare{Field: FieldRuntime, Op: OpGt, Value: 90}}}},
+		{"rating:>=7.5", &And{Terms: []Node{&Compare{Field: FieldRating, Op: OpGe, Value: 7.5}}}},
+		{"-watched:me", &And{Terms: []Node{&Not{Term: &UserHas{Field: FieldWatched, Username: Me}}}}},
+		{"-type:series wants:bob", &And{Terms: []Node{
+			&Not{Term: &OneOf{Field: FieldType, Values: []string{"series"}}},
+			&UserHas{Field: FieldWants, Username: "bob"},
+		}}},
+		{`star year:>2000 "the wars"`, &And{Terms: []Node{
+			&Text{Words: []string{"star", "the wars"}},
+			&Compare{Field: FieldYear, Op: OpGt, Value: 2000},
+		}}},
+		{"a,b", &And{Terms: []Node{&Text{Words: []string{"a,b"}}}}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.filter)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   SyntaxError
+	}{
+		{`type:movie "star wars`, SyntaxError{Pos: 11, Token: `"star wars`, Message: "unterminated quote"}},
+		{`-genre:"drama`, SyntaxError{Pos: 0, Token: `-genre:"drama`, Message: "unterminated quote"}},
+		{"year:>1990 :movie", SyntaxError{Pos: 11, Token: ":movie", Message: "missing field name"}},
+		{"type:movie -star", SyntaxError{Pos: 11, Token: "-star", Message: "search words can't be negated"}},
+		{"year:1990,2000", SyntaxError{Pos: 0, Token: "year:1990,2000", Message: "year takes a single value"}},
+		{"runtime:long", SyntaxError{Pos: 0, Token: "runtime:long", Message: "runtime must be a whole number"}},
+		{"rating:11", SyntaxError{Pos: 0, Token: "rating:11", Message: "rating must be a number between 0 and 10"}},
+		{"service:netflix,", SyntaxError{Pos: 0, Token: "service:netflix,", Message: "missing service"}},
+		{"genre:>drama", SyntaxError{Pos: 0, Token: "genre:>drama", Message: "genre can't be compared with `>`"}},
+		{"x  type:show", SyntaxError{Pos: 3, Token: "type:show", Message: "type must be `movie` or `series`"}},
+		{"watched:", SyntaxError{Pos: 0, Token: "watched:", Message: "watched takes a single username, or `me`"}},
+		{"colour:red", SyntaxError{Pos: 0, Token: "colour:red", Message: "unknown field `colour`"}},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.filter)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) returned %v, want a *SyntaxError", test.filter, err)
+			continue
+		}
+		if *syntaxErr != test.want {
+			t.Errorf("Parse(%q) returned %#v, want %#v", test.filter, *syntaxErr, test.want)
+		}
+	}
+}
+
+func TestSyntaxErrorColumn(t *testing.T) {
+	err := &SyntaxError{Pos: 11, Token: "-star", Message: "search words can't be negated"}
+	want := "search words can't be negated at column 12: `-star`"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// Package imdb reads the IMDb non-commercial TSV datasets.
+// See https://developer.imdb.com/non-commercial-datasets/ for the file formats.
+package imdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The datasets use `\N` to represent a missing value.
+const nullValue = `\N`
+
+// Lines in the datasets are short, but leave plenty of headroom for long titles.
+const maxLineLength = 1024 * 1024
+
+var ErrMalformedDataset = errors.New("malformed dataset")
+
+type Rating struct {
+	AverageRating float64
+	NumVotes      int64
+}
+
+// titleTypes maps the IMDb titleType values that fwip cares about to fwip title types.
+// Everything else (episodes, shorts, video games, etc.) is skipped.
+var titleTypes = map[string]string{
+	"movie":        model.TitleTypeMovie,
+	"tvMovie":      model.TitleTypeMovie,
+	"tvSeries":     model.TitleTypeSeries,
+	"tvMiniSeries": model.TitleTypeSeries,
+}
+
+// ReadRatings reads a title.ratings dataset into a map keyed on IMDb ID.
+func ReadRatings(r io.Reader) (map[string]Rating, error) {
+	ratings := make(map[string]Rating)
+	err := readRows(r, []string{"tconst", "averageRating", "numVotes"}, func(row []string) error {
+		averageRating, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid rating for %s: %w", row[0], err)
+		}
+		numVotes, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid vote count for %s: %w", row[0], err)
+		}
+		ratings[row[0]] = Rating{AverageRating: averageRating, NumVotes: numVotes}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+// ReadBasics streams a title.basics dataset, calling fn for each title of a supported type.
+// Adult titles are skipped unless includeAdult is set.
+func ReadBasics(r io.Reader, includeAdult bool, fn func(title *model.Title) error) error {
+	columns := []string{
+		"tconst",
+		"titleType",
+		"primaryTitle",
+		"originalTitle",
+		"isAdult",
+		"startYear",
+		"endYear",
+		"runtimeMinutes",
+		"genres",
+	}
+	return readRows(r, columns, func(row []string) error {
+		titleType, ok := titleTypes[row[1]]
+		if !ok {
+			return nil
+		}
+		if row[4] == "1" && !includeAdult {
+			return nil
+		}
+		year, err := parseOptionalInt(row[5])
+		if err != nil {
+			return fmt.Errorf("invalid year for %s: %w", row[0], err)
+		}
+		runtime, err := parseOptionalInt(row[7])
+		if err != nil {
+			return fmt.Errorf("invalid runtime for %s: %w", row[0], err)
+		}
+		var genres []string
+		if row[8] != nullValue {
+			genres = strings.Split(row[8], ",")
+		}
+		return fn(&model.Title{
+			Id:      model.NoId,
+			ImdbId:  row[0],
+			Type:    titleType,
+			Name:    row[2],
+			Year:    year,
+			Runtime: runtime,
+			Genres:  genres,
+		})
+	})
+}
+
+// readRows reads a dataset line by line, checking the header against the expected columns.
+func readRows(r io.Reader, columns []string, fn func(row []string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: missing header", ErrMalformedDataset)
+	}
+	header := strings.Split(scanner.Text(), "\t")
+	if len(header) != len(columns) {
+		return fmt.Errorf("%w: expected columns %v but got %v", ErrMalformedDataset, columns, header)
+	}
+	for i, column := range columns {
+		if header[i] != column {
+			return fmt.Errorf("%w: expected columns %v but got %v", ErrMalformedDataset, columns, header)
+		}
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		row := strings.Split(scanner.Text(), "\t")
+		if len(row) != len(columns) {
+			return fmt.Errorf("%w: line %d has %d columns", ErrMalformedDataset, line, len(row))
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func parseOptionalInt(value string) (int64, error) {
+	if value == nullValue {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Scopes limit what an API token may be used for.
+const (
+	// ScopeRead allows reading anything the user can read, but nothing else.
+	ScopeRead = "read"
+	// ScopeWatchHistoryWrite allows recording the user's watch history.
+	ScopeWatchHistoryWrite = "watch_history:write"
+	// ScopeCatalogWrite allows changing titles and which services carry them.
+	ScopeCatalogWrite = "catalog:write"
+	// ScopeChangeRequestsWrite allows submitting and moderating change requests.
+	ScopeChangeRequestsWrite = "change_requests:write"
+	// ScopeAccountWrite allows changing the user's account, including their API tokens.
+	ScopeAccountWrite = "account:write"
+	// ScopeListsWrite allows changing the user's lists.
+	ScopeListsWrite = "lists:write"
+	// ScopeRatingsWrite allows rating and reviewing titles as the user.
+	ScopeRatingsWrite = "ratings:write"
+)
+
+var validScopes = map[string]bool{
+	ScopeRead:                true,
+	ScopeWatchHistoryWrite:   true,
+	ScopeCatalogWrite:        true,
+	ScopeChangeRequestsWrite: true,
+	ScopeAccountWrite:        true,
+	ScopeListsWrite:          true,
+	ScopeRatingsWrite:        true,
+}
+
+// An ApiToken lets scripts act as a user without their password.
+// A token with no scopes may do anything its user can.
+type ApiToken struct {
+	Id         Identifier `json:"id"`
+	UserId     UserId     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  string     `json:"created_at"`
+	LastUsedAt string     `json:"last_used_at,omitempty"`
+	// Token is only ever set in the response to creating the token, since only its hash is stored.
+	Token string `json:"token,omitempty"`
+}
+
+func (t *ApiToken) Validate() error {
+	if t.Name == "" {
+		return errors.New("missing name")
+	}
+	for _, scope := range t.Scopes {
+		if !validScopes[scope] {
+			return fmt.Errorf("unknown scope `%s`", scope)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the token may be used for something requiring the given scope.
+func (t *ApiToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the token may already do everything a token with the given scopes could, so that
+// tokens can't be used to mint more powerful ones.
+func (t *ApiToken) Covers(scopes []string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if !t.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
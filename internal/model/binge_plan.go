@@ -0,0 +1,29 @@
+package model
+
+// A BingePlan schedules the rest of a series into the time a user has to watch it each day.
+type BingePlan struct {
+	Title *Title `json:"title"`
+	Start string `json:"start"`
+	// FinishDate is the day the last episode is watched, or empty if there's nothing left to watch.
+	FinishDate   string `json:"finish_date,omitempty"`
+	EpisodesLeft int64  `json:"episodes_left"`
+	// RuntimeLeft is in minutes, counting episodes whose runtime isn't known as the series' average.
+	RuntimeLeft int64       `json:"runtime_left"`
+	Days        []*BingeDay `json:"days"`
+	// Deadlines are the services the title is leaving, and whether the plan finishes in time.
+	Deadlines []*BingeDeadline `json:"deadlines"`
+}
+
+// A BingeDay is what to watch on one day of a binge plan. Days without anything to watch are left out.
+type BingeDay struct {
+	Date     string     `json:"date"`
+	Minutes  int64      `json:"minutes"`
+	Episodes []*Episode `json:"episodes"`
+}
+
+type BingeDeadline struct {
+	ServiceId      ServiceId `json:"service_id"`
+	ServiceName    string    `json:"service_name"`
+	AvailableUntil string    `json:"available_until"`
+	FinishesInTime bool      `json:"finishes_in_time"`
+}
@@ -0,0 +1,83 @@
+package model
+
+import "errors"
+
+const (
+	ChangeRequestAdd    = "add"
+	ChangeRequestEdit   = "edit"
+	ChangeRequestMove   = "move"
+	ChangeRequestDelete = "delete"
+)
+
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApproved = "approved"
+	ChangeRequestRejected = "rejected"
+)
+
+// A ChangeRequest is a change to the catalog proposed by a user, which must be approved before it takes effect.
+//
+// The fields used depend on the kind of change:
+//   - add: Title, and optionally ToServiceId to make the new title available on a service.
+//   - edit: TitleId and the complete replacement Title.
+//   - move: TitleId, FromServiceId and ToServiceId.
+//   - delete: TitleId and Reason. If FromServiceId is set, the title is only removed from that service.
+type ChangeRequest struct {
+	Id            Identifier `json:"id"`
+	UserId        UserId     `json:"user_id"`
+	Kind          string     `json:"kind"`
+	Status        string     `json:"status"`
+	TitleId       TitleId    `json:"title_id,omitzero"`
+	Title         *Title     `json:"title,omitempty"`
+	FromServiceId ServiceId  `json:"from_service_id,omitzero"`
+	ToServiceId   ServiceId  `json:"to_service_id,omitzero"`
+	Reason        string     `json:"reason,omitempty"`
+	CreatedAt     string     `json:"created_at"`
+	ResolvedAt    string     `json:"resolved_at,omitempty"`
+}
+
+// Validate checks that the fields needed for the kind of change are present and well-formed.
+func (cr *ChangeRequest) Validate() error {
+	if cr.UserId == NoId {
+		return errors.New("missing user_id")
+	}
+	switch cr.Kind {
+	case ChangeRequestAdd:
+		if cr.Title == nil {
+			return errors.New("missing title")
+		}
+		if cr.TitleId != NoId {
+			return errors.New("title_id must not be set when adding a title")
+		}
+		return cr.Title.Validate()
+	case ChangeRequestEdit:
+		if cr.TitleId == NoId {
+			return errors.New("missing title_id")
+		}
+		if cr.Title == nil {
+			return errors.New("missing title")
+		}
+		return cr.Title.Validate()
+	case ChangeRequestMove:
+		if cr.TitleId == NoId {
+			return errors.New("missing title_id")
+		}
+		if cr.FromServiceId == NoId || cr.ToServiceId == NoId {
+			return errors.New("moving a title requires from_service_id and to_service_id")
+		}
+		if cr.FromServiceId == cr.ToServiceId {
+			return errors.New("from_service_id and to_service_id must differ")
+		}
+		return nil
+	case ChangeRequestDelete:
+		if cr.TitleId == NoId {
+			return errors.New("missing title_id")
+		}
+		if cr.Reason == "" {
+			return errors.New("a reason is required when deleting a title")
+		}
+		return nil
+	default:
+		return errors.New("kind must be one of `add`, `edit`, `move` or `delete`")
+	}
+}
@@ -0,0 +1,38 @@
+package model
+
+import "errors"
+
+const (
+	CreditRoleActor    = "actor"
+	CreditRoleDirector = "director"
+	CreditRoleWriter   = "writer"
+)
+
+// A Credit records a person's part in making a title.
+// When saving a credit for someone not yet in the catalog, leave PersonId unset and give their Name.
+type Credit struct {
+	PersonId Identifier `json:"person_id"`
+	Name     string     `json:"name"`
+	Role     string     `json:"role"`
+	// Billing orders the credits for each role, lowest first.
+	Billing int64 `json:"billing"`
+}
+
+func IsValidCreditRole(role string) bool {
+	return role == CreditRoleActor || role == CreditRoleDirector || role == CreditRoleWriter
+}
+
+// Validate checks that the credit's fields are well-formed, returning an error describing
+// the first problem found.
+func (c *Credit) Validate() error {
+	if c.PersonId == NoId && c.Name == "" {
+		return errors.New("credit must have a person_id or name")
+	}
+	if !IsValidCreditRole(c.Role) {
+		return errors.New("credit role must be `actor`, `director` or `writer`")
+	}
+	if c.Billing < 0 {
+		return errors.New("credit billing must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// A Season is one season of a series. Season 0 holds the series' specials.
+type Season struct {
+	Id           Identifier `json:"id"`
+	TitleId      TitleId    `json:"title_id"`
+	Number       int64      `json:"number"`
+	Name         string     `json:"name"`
+	AirDate      string     `json:"air_date"`
+	EpisodeCount int64      `json:"episode_count"`
+	// Episodes are only filled in when a season is saved. Saving a season replaces all of its episodes.
+	Episodes []*Episode `json:"episodes,omitempty"`
+}
+
+// Validate checks that the season and its episodes are well-formed, returning an error describing
+// the first problem found.
+func (s *Season) Validate() error {
+	if s.Number < 0 {
+		return errors.New("number must not be negative")
+	}
+	if s.Name == "" {
+		return errors.New("missing name")
+	}
+	if err := validateAirDate(s.AirDate); err != nil {
+		return err
+	}
+	numbered := make(map[int64]bool)
+	for _, episode := range s.Episodes {
+		if episode == nil {
+			return errors.New("episodes must not be null")
+		}
+		if err := episode.Validate(); err != nil {
+			return err
+		}
+		if numbered[episode.Number] {
+			return errors.New("episode numbers must be unique within a season")
+		}
+		numbered[episode.Number] = true
+	}
+	return nil
+}
+
+type Episode struct {
+	Id           Identifier `json:"id"`
+	TitleId      TitleId    `json:"title_id"`
+	SeasonNumber int64      `json:"season_number"`
+	Number       int64      `json:"number"`
+	Name         string     `json:"name"`
+	AirDate      string     `json:"air_date"`
+	// Runtime is in minutes, or zero if it isn't known.
+	Runtime int64 `json:"runtime"`
+}
+
+func (e *Episode) Validate() error {
+	if e.Number < 1 {
+		return errors.New("episode number must be positive")
+	}
+	if e.Name == "" {
+		return errors.New("missing episode name")
+	}
+	if err := validateAirDate(e.AirDate); err != nil {
+		return err
+	}
+	if e.Runtime < 0 {
+		return errors.New("episode runtime must not be negative")
+	}
+	return nil
+}
+
+// TotalRuntime adds up the runtimes of the episodes in minutes, counting those whose runtime isn't known
+// as lasting averageRuntime.
+func TotalRuntime(episodes []*Episode, averageRuntime int64) int64 {
+	var total int64
+	for _, episode := range episodes {
+		if episode.Runtime > 0 {
+			total += episode.Runtime
+		} else {
+			total += averageRuntime
+		}
+	}
+	return total
+}
+
+func validateAirDate(airDate string) error {
+	if airDate == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.DateOnly, airDate); err != nil {
+		return errors.New("air_date must be formatted as YYYY-MM-DD")
+	}
+	return nil
+}
+
+// A NextUp is the next episode to watch of a series the user is part way through.
+type NextUp struct {
+	Title   *Title   `json:"title"`
+	Episode *Episode `json:"episode"`
+	// EpisodesLeft counts the next episode and every one after it, leaving out specials and episodes that
+	// haven't aired yet.
+	EpisodesLeft int64 `json:"episodes_left"`
+	// RuntimeLeft is the total runtime of the episodes left in minutes. Episodes whose runtime isn't known
+	// are counted as lasting the series' average episode runtime.
+	RuntimeLeft   int64  `json:"runtime_left"`
+	LastWatchedAt string `json:"last_watched_at"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "errors"
+
+// A List is an ordered list of titles, curated by its owner and any members they add.
+type List struct {
+	Id          Identifier `json:"id"`
+	UserId      UserId     `json:"user_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	CreatedAt   string     `json:"created_at"`
+	// MemberIds are the users other than the owner who may change the list's items.
+	MemberIds []UserId `json:"member_ids"`
+	// Items are only filled in when a single list is retrieved.
+	Items []*ListItem `json:"items,omitempty"`
+}
+
+func (l *List) Validate() error {
+	if l.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+// CanEdit reports whether the user may change the list's items.
+func (l *List) CanEdit(userId UserId) bool {
+	if l.UserId == userId {
+		return true
+	}
+	for _, memberId := range l.MemberIds {
+		if memberId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+type ListItem struct {
+	TitleId TitleId `json:"title_id"`
+	// Position is the item's place in the list, starting from zero.
+	Position int64  `json:"position"`
+	AddedBy  UserId `json:"added_by"`
+	AddedAt  string `json:"added_at"`
+	Title    *Title `json:"title,omitempty"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// A Person is someone credited on titles in the catalog.
+type Person struct {
+	Id   Identifier `json:"id"`
+	Name string     `json:"name"`
+}
+
+// A PersonCredit is a person's credit on a title, as listed in their filmography.
+type PersonCredit struct {
+	Role    string `json:"role"`
+	Billing int64  `json:"billing"`
+	Title   *Title `json:"title"`
+}
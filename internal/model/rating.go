@@ -0,0 +1,35 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"unicode/utf8"
+)
+
+const maxReviewLength = 10000
+
+// A Rating is what a user thinks of a title overall, in stars and optionally in words.
+type Rating struct {
+	UserId  UserId  `json:"user_id"`
+	TitleId TitleId `json:"title_id"`
+	// Rating is from 0.5 to 5 stars in steps of half a star.
+	Rating    float64 `json:"rating"`
+	Review    string  `json:"review,omitempty"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// IsValidRating reports whether rating is a whole or half number of stars from 0.5 to 5.
+func IsValidRating(rating float64) bool {
+	return rating >= 0.5 && rating <= 5 && rating*2 == math.Trunc(rating*2)
+}
+
+func (r *Rating) Validate() error {
+	if !IsValidRating(r.Rating) {
+		return errors.New("rating must be from 0.5 to 5 in steps of 0.5")
+	}
+	if utf8.RuneCountInString(r.Review) > maxReviewLength {
+		return errors.New("review must not be longer than 10000 characters")
+	}
+	return nil
+}
@@ -1,6 +1,6 @@
 package model
 
 type Service struct {
-	Id   int64  `json:"id"`
-	Name string `json:"name"`
+	Id   ServiceId `json:"id"`
+	Name string    `json:"name"`
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// A ServiceTitle records that a title is available on a service, optionally only within a window of dates.
+type ServiceTitle struct {
+	ServiceId      ServiceId `json:"service_id"`
+	TitleId        TitleId   `json:"title_id"`
+	AvailableFrom  string    `json:"available_from,omitempty"`
+	AvailableUntil string    `json:"available_until,omitempty"`
+	Title          *Title    `json:"title,omitempty"`
+}
+
+// Validate checks that the availability window is made of YYYY-MM-DD dates in the right order.
+func (st *ServiceTitle) Validate() error {
+	if st.AvailableFrom != "" {
+		if _, err := time.Parse(time.DateOnly, st.AvailableFrom); err != nil {
+			return errors.New("available_from must be formatted as YYYY-MM-DD")
+		}
+	}
+	if st.AvailableUntil != "" {
+		if _, err := time.Parse(time.DateOnly, st.AvailableUntil); err != nil {
+			return errors.New("available_until must be formatted as YYYY-MM-DD")
+		}
+	}
+	if st.AvailableFrom != "" && st.AvailableUntil != "" && st.AvailableUntil < st.AvailableFrom {
+		return errors.New("available_until must not be before available_from")
+	}
+	return nil
+}
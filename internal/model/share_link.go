@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// What a share link shows.
+const (
+	ShareKindList        = "list"
+	ShareKindWatched     = "watched"
+	ShareKindWantToWatch = "want_to_watch"
+)
+
+// A ShareLink lets anyone with its token see one of a user's lists, or the titles they've watched or want to
+// watch, without an account.
+type ShareLink struct {
+	Id     Identifier `json:"id"`
+	UserId UserId     `json:"user_id"`
+	Kind   string     `json:"kind"`
+	// ListId is only set for links to a list.
+	ListId    Identifier `json:"list_id,omitzero"`
+	CreatedAt string     `json:"created_at"`
+	// Token is only ever set in the response to creating the link, since only its hash is stored.
+	Token string `json:"token,omitempty"`
+}
+
+func (l *ShareLink) Validate() error {
+	switch l.Kind {
+	case ShareKindList:
+		if l.ListId == NoId {
+			return errors.New("missing list_id")
+		}
+	case ShareKindWatched, ShareKindWantToWatch:
+		if l.ListId != NoId {
+			return fmt.Errorf("list_id can't be given for `%s`", l.Kind)
+		}
+	default:
+		return fmt.Errorf("kind must be `%s`, `%s` or `%s`", ShareKindList, ShareKindWatched, ShareKindWantToWatch)
+	}
+	return nil
+}
+
+// A SharedView is what a share link shows.
+type SharedView struct {
+	Kind        string   `json:"kind"`
+	Username    string   `json:"username"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Titles      []*Title `json:"titles"`
+}
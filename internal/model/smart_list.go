@@ -0,0 +1,34 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/expr"
+)
+
+// A SmartList is a saved filter whose titles are worked out whenever it is used, like
+// `service:hulu,max type:movie genre:comedy runtime:<100 -watched:me`.
+// Within a smart list, `me` refers to the list's owner.
+type SmartList struct {
+	Id        Identifier `json:"id"`
+	UserId    UserId     `json:"user_id"`
+	Name      string     `json:"name"`
+	Filter    string     `json:"filter"`
+	CreatedAt string     `json:"created_at"`
+	// UserIds are the users the filter names, other than `me`, by the username they had when the list was
+	// saved. They're only loaded by GetSmartListUsers.
+	UserIds map[string]UserId `json:"-"`
+}
+
+func (l *SmartList) Validate() error {
+	if l.Name == "" {
+		return errors.New("missing name")
+	}
+	if l.Filter == "" {
+		return errors.New("missing filter")
+	}
+	if _, err := expr.Parse(l.Filter); err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,100 @@
 package model
 
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+const (
+	TitleTypeMovie  = "movie"
+	TitleTypeSeries = "series"
+)
+
+var imdbIdPattern = regexp.MustCompile(`^tt[0-9]+$`)
+
 type Title struct {
-	Id          int64  `json:"id"`
-	ImdbId      string `json:"imdb_id"`
-	Type        string `json:"type"`
-	Name        string `json:"name"`
-	Year        int64  `json:"year"`
-	ReleaseDate string `json:"release_date"`
-	Runtime     int64  `json:"runtime"`
+	Id          TitleId `json:"id"`
+	ImdbId      string  `json:"imdb_id"`
+	Type        string  `json:"type"`
+	Name        string  `json:"name"`
+	Year        int64   `json:"year"`
+	ReleaseDate string  `json:"release_date"`
+	Runtime     int64   `json:"runtime"`
+	ImdbRating  float64 `json:"imdb_rating"`
+	ImdbVotes   int64   `json:"imdb_votes"`
+	Description string  `json:"description"`
+	// EpisodeCount and AverageEpisodeRuntime are only filled in when a single title is retrieved or picked,
+	// and are zero for movies and for series without any episodes yet.
+	EpisodeCount          int64 `json:"episode_count,omitempty"`
+	AverageEpisodeRuntime int64 `json:"average_episode_runtime,omitempty"`
+	// UserRating is the average of fwip users' ratings, out of 5 stars. Like the episode counts, it and
+	// UserRatingCount are only filled in when a single title is retrieved or picked.
+	UserRating      float64 `json:"user_rating,omitempty"`
+	UserRatingCount int64   `json:"user_rating_count,omitempty"`
+	// Genres and Credits are only filled in when a single title is retrieved.
+	// When saving a title, leaving them nil keeps the existing ones.
+	Genres  []string  `json:"genres,omitempty"`
+	Credits []*Credit `json:"credits,omitempty"`
+}
+
+// Validate checks that the title's fields are well-formed, returning an error describing
+// the first problem found.
+func (t *Title) Validate() error {
+	if !imdbIdPattern.MatchString(t.ImdbId) {
+		return errors.New("imdb_id must look like `tt0123456`")
+	}
+	if t.Type != TitleTypeMovie && t.Type != TitleTypeSeries {
+		return errors.New("type must be `movie` or `series`")
+	}
+	if t.Name == "" {
+		return errors.New("missing name")
+	}
+	if t.Year < 0 || t.Year > 9999 {
+		return errors.New("year must be between 0 and 9999")
+	}
+	if t.ReleaseDate != "" {
+		if _, err := time.Parse(time.DateOnly, t.ReleaseDate); err != nil {
+			return errors.New("release_date must be formatted as YYYY-MM-DD")
+		}
+	}
+	if t.Runtime < 0 {
+		return errors.New("runtime must not be negative")
+	}
+	if t.ImdbRating < 0 || t.ImdbRating > 10 {
+		return errors.New("imdb_rating must be between 0 and 10")
+	}
+	if t.ImdbVotes < 0 {
+		return errors.New("imdb_votes must not be negative")
+	}
+	for _, genre := range t.Genres {
+		if genre == "" {
+			return errors.New("genres must not be empty")
+		}
+	}
+	// Credits by name are told apart by name. Someone credited both by ID and by name can only be caught
+	// once the name has been looked up, which happens when the credits are saved.
+	type creditKey struct {
+		personId Identifier
+		name     string
+		role     string
+	}
+	credited := make(map[creditKey]bool)
+	for _, credit := range t.Credits {
+		if credit == nil {
+			return errors.New("credits must not be null")
+		}
+		if err := credit.Validate(); err != nil {
+			return err
+		}
+		key := creditKey{personId: credit.PersonId, role: credit.Role}
+		if credit.PersonId == NoId {
+			key.name = credit.Name
+		}
+		if credited[key] {
+			return errors.New("a person may only be credited once per role")
+		}
+		credited[key] = true
+	}
+	return nil
 }
@@ -1,6 +1,23 @@
 package model
 
+const (
+	// RoleAdmin users curate the catalog and moderate change requests.
+	RoleAdmin = "admin"
+	// RoleMember users manage their own watch history and propose catalog changes.
+	RoleMember = "member"
+)
+
 type User struct {
-	Id       int64  `json:"id"`
-	Username string `json:"username"`
+	Id           UserId `json:"id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	PickStrategy string `json:"pick_strategy,omitempty"`
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleMember
 }
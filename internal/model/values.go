@@ -8,19 +8,30 @@ import (
 
 const idEncodingBase = 36
 
+// An Identifier is the ID of something stored in the catalog. IDs are random 63-bit integers, and are
+// encoded in base36 outside the server so that they make shorter URLs.
 type Identifier struct {
 	value int64
 }
 
 type (
-	TitleId = Identifier
+	TitleId   = Identifier
+	UserId    = Identifier
+	ServiceId = Identifier
 )
 
-var NoId int64 = 0
+// NoId is the zero Identifier, which no stored thing has.
+var NoId = Identifier{}
 
+// NewIdentifier wraps an ID as it is stored in the database.
+func NewIdentifier(value int64) Identifier {
+	return Identifier{value: value}
+}
+
+// IdentifierFromString parses the base36 form of an ID, as produced by String.
 func IdentifierFromString(valueStr string) (Identifier, error) {
 	value, err := strconv.ParseInt(valueStr, idEncodingBase, 64)
-	if err != nil {
+	if err != nil || value < 0 {
 		return Identifier{}, fmt.Errorf("invalid identifier format `%s`", valueStr)
 	}
 	return Identifier{value: value}, nil
@@ -46,6 +57,16 @@ func (id Identifier) MarshalJSON() ([]byte, error) {
 	return json.Marshal(id.String())
 }
 
+//goland:noinspection GoMixedReceiverTypes
+func (id *Identifier) UnmarshalText(text []byte) error {
+	idInt, err := IdentifierFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*id = idInt
+	return nil
+}
+
 //goland:noinspection GoMixedReceiverTypes
 func (id *Identifier) UnmarshalJSON(b []byte) error {
 	var idString string
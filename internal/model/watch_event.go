@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// Where watch events come from, when the client doesn't say.
+const (
+	WatchSourceManual = "manual"
+	// WatchSourceWatchHistory marks events recorded by setting watched in the user's watch history.
+	WatchSourceWatchHistory = "watch_history"
+)
+
+// A WatchEvent records one time a user watched a title, or one episode of it.
+type WatchEvent struct {
+	Id        Identifier `json:"id"`
+	UserId    UserId     `json:"user_id"`
+	TitleId   TitleId    `json:"title_id"`
+	WatchedAt string     `json:"watched_at"`
+	// EpisodeId is only set when a single episode was watched rather than the whole title.
+	EpisodeId Identifier `json:"episode_id,omitzero"`
+	// Rating is from 0.5 to 5 stars in steps of half a star, or zero if the user didn't rate it.
+	Rating float64 `json:"rating,omitempty"`
+	Source string  `json:"source"`
+}
+
+func (e *WatchEvent) Validate() error {
+	if e.TitleId == NoId {
+		return errors.New("missing title_id")
+	}
+	watchedAt, err := time.Parse(time.RFC3339, e.WatchedAt)
+	if err != nil {
+		return errors.New("watched_at must be an RFC 3339 timestamp")
+	}
+	if watchedAt.After(time.Now()) {
+		return errors.New("watched_at can't be in the future")
+	}
+	if e.Rating != 0 && !IsValidRating(e.Rating) {
+		return errors.New("rating must be from 0.5 to 5 in steps of 0.5")
+	}
+	if e.Source == "" {
+		return errors.New("missing source")
+	}
+	return nil
+}
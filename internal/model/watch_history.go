@@ -1,8 +1,15 @@
 package model
 
+// A WatchHistory is what a user thinks of a title. Watched and the watch counts are worked out from the
+// user's watch events for the whole title, and EpisodesWatched from those for its episodes.
 type WatchHistory struct {
-	UserId      int64 `json:"user_id"`
-	TitleId     int64 `json:"title_id"`
-	Watched     bool  `json:"watched"`
-	WantToWatch int64 `json:"want_to_watch"`
+	UserId        UserId  `json:"user_id"`
+	TitleId       TitleId `json:"title_id"`
+	Watched       bool    `json:"watched"`
+	WatchCount    int64   `json:"watch_count"`
+	LastWatchedAt string  `json:"last_watched_at,omitempty"`
+	// EpisodesWatched is how many different episodes of a series the user has watched.
+	EpisodesWatched int64  `json:"episodes_watched,omitempty"`
+	WantToWatch     int64  `json:"want_to_watch"`
+	WantedSince     string `json:"wanted_since,omitempty"`
 }
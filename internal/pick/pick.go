@@ -0,0 +1,122 @@
+// Package pick implements the strategies fwip uses to choose a title to watch.
+package pick
+
+import (
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"sort"
+)
+
+// Default is the name of the strategy used when neither the request nor the user chooses one.
+const Default = "weighted"
+
+// A Picker chooses a title for a user from the titles matching the criteria. The strategies here each
+// order the candidates with their own ORDER BY clause for repository.PickTitle, always breaking ties randomly.
+type Picker interface {
+	// Name identifies the strategy in requests and user preferences.
+	Name() string
+	Pick(repo *repository.Repository, criteria repository.PickCriteria) (*model.Title, error)
+}
+
+var pickers = map[string]Picker{}
+
+func register(picker Picker) {
+	pickers[picker.Name()] = picker
+}
+
+func init() {
+	register(Uniform{})
+	register(Weighted{})
+	register(OldestWanted{})
+	register(ShortestRuntime{})
+	register(LeavingSoonest{})
+}
+
+// Get looks up a Picker by name.
+func Get(name string) (Picker, error) {
+	picker, ok := pickers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pick strategy `%s`", name)
+	}
+	return picker, nil
+}
+
+// Names lists the names of every available strategy in alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(pickers))
+	for name := range pickers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Uniform picks any unwatched title with equal probability.
+type Uniform struct{}
+
+func (Uniform) Name() string { return "uniform" }
+
+func (Uniform) Pick(repo *repository.Repository, criteria repository.PickCriteria) (*model.Title, error) {
+	return repo.PickTitle(criteria, `random()`)
+}
+
+// Weighted picks randomly, making each title's chance of being picked proportional to one plus the users'
+// combined want_to_watch for it.
+//
+// The pick is made in a single pass over the candidates: each one is given the key -ln(u)/weight for a
+// uniformly random u, and the smallest key wins (Efraimidis-Spirakis sampling).
+type Weighted struct{}
+
+func (Weighted) Name() string { return "weighted" }
+
+func (Weighted) Pick(repo *repository.Repository, criteria repository.PickCriteria) (*model.Title, error) {
+	return repo.PickTitle(criteria, `
+	-ln(((random() & 9223372036854775807) + 1.0) / 9223372036854775808.0)
+		/ (1 + coalesce(wh.want_to_watch, 0))`,
+	)
+}
+
+// OldestWanted picks the title that has been on any of the users' want-to-watch lists the longest.
+type OldestWanted struct{}
+
+func (OldestWanted) Name() string { return "oldest_wanted" }
+
+func (OldestWanted) Pick(repo *repository.Repository, criteria repository.PickCriteria) (*model.Title, error) {
+	return repo.PickTitle(criteria, `
+	CASE WHEN wh.want_to_watch > 0 THEN wh.wanted_since END NULLS LAST,
+	random()`,
+	)
+}
+
+// ShortestRuntime picks the shortest unwatched title. Titles with an unknown runtime come last.
+type ShortestRuntime struct{}
+
+func (ShortestRuntime) Name() string { return "shortest_runtime" }
+
+func (ShortestRuntime) Pick(repo *repository.Repository, criteria repository.PickCriteria) (*model.Title, error) {
+	return repo.PickTitle(criteria, `
+	nullif(t.runtime, 0) NULLS LAST,
+	random()`,
+	)
+}
+
+// LeavingSoonest picks the unwatched title that is about to leave a service, only counting the requested
+// service if there is one. Titles with no known end to their availability come last.
+type LeavingSoonest struct{}
+
+func (LeavingSoonest) Name() string { return "leaving_soonest" }
+
+func (LeavingSoonest) Pick(repo *repository.Repository, criteria repository.PickCriteria) (*model.Title, error) {
+	return repo.PickTitle(criteria, `
+	(
+		SELECT min(st.available_until)
+		FROM service_title st
+		WHERE st.title_id = t.id
+			AND ($serviceId IS NULL OR st.service_id = $serviceId)
+			AND (st.available_from IS NULL OR st.available_from <= $today)
+			AND st.available_until >= $today
+	) NULLS LAST,
+	random()`,
+	)
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"strings"
+	"time"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var ErrNoSuchApiToken = errors.New("API token does not exist")
+
+// lastUsedResolution is how stale an API token's last_used_at may get before it is updated,
+// so that scripts making many requests don't cause a write for every one.
+const lastUsedResolution = time.Minute
+
+func (r *Repository) GetUserApiTokens(userId model.UserId) ([]*model.ApiToken, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, name, scopes, created_at, last_used_at
+FROM api_token
+WHERE user_id = $userId
+ORDER BY created_at, id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+
+	tokens := make([]*model.ApiToken, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve API tokens: %w", err)
+		} else if !hasRow {
+			break
+		}
+		tokens = append(tokens, apiTokenFromStmt(stmt))
+	}
+
+	return tokens, nil
+}
+
+// CreateApiToken stores a new API token, identified by the hash of its secret value.
+func (r *Repository) CreateApiToken(token *model.ApiToken, tokenHash string) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+INSERT INTO api_token (
+	id,
+	user_id,
+	name,
+	token_hash,
+	scopes,
+	created_at
+)
+VALUES (
+	$id,
+	$userId,
+	$name,
+	$tokenHash,
+	$scopes,
+	$createdAt
+)
+;`,
+	)
+	defer stmt.Reset()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$userId", token.UserId.Int())
+	stmt.SetText("$name", token.Name)
+	stmt.SetText("$tokenHash", tokenHash)
+	stmt.SetText("$scopes", strings.Join(token.Scopes, " "))
+	stmt.SetText("$createdAt", createdAt)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		return model.NoId, fmt.Errorf("failed to create API token: %w", err)
+	}
+	token.Id = model.NewIdentifier(id)
+	token.CreatedAt = createdAt
+
+	return token.Id, nil
+}
+
+// DeleteApiToken revokes one of the user's API tokens.
+func (r *Repository) DeleteApiToken(userId model.UserId, tokenId model.Identifier) error {
+	stmt := r.conn.Prep(`
+DELETE FROM api_token
+WHERE id = $id AND user_id = $userId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", tokenId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete API token %s: %w", tokenId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchApiToken
+	}
+	return nil
+}
+
+// UseApiToken looks up the API token with the given hash and its user, recording that the token was used.
+func (r *Repository) UseApiToken(tokenHash string) (user *model.User, token *model.ApiToken, err error) {
+	defer r.Transact()(&err)
+	stmt := r.conn.Prep(`
+SELECT
+	t.id, t.user_id, t.name, t.scopes, t.created_at, t.last_used_at,
+	u.username, u.role, u.pick_strategy
+FROM api_token t
+INNER JOIN user u ON u.id = t.user_id
+WHERE t.token_hash = $tokenHash
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$tokenHash", tokenHash)
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve API token: %w", err)
+	} else if !hasRow {
+		return nil, nil, ErrNoSuchApiToken
+	}
+	token = apiTokenFromStmt(stmt)
+	user = &model.User{
+		Id:           token.UserId,
+		Username:     stmt.GetText("username"),
+		Role:         stmt.GetText("role"),
+		PickStrategy: stmt.GetText("pick_strategy"),
+	}
+
+	now := time.Now().UTC()
+	updateStmt := r.conn.Prep(`
+UPDATE api_token
+SET last_used_at = $now
+WHERE id = $id AND (last_used_at IS NULL OR last_used_at < $staleBefore)
+;`,
+	)
+	defer updateStmt.Reset()
+	updateStmt.SetInt64("$id", token.Id.Int())
+	updateStmt.SetText("$now", now.Format(time.RFC3339))
+	updateStmt.SetText("$staleBefore", now.Add(-lastUsedResolution).Format(time.RFC3339))
+	if _, err = updateStmt.Step(); err != nil {
+		return nil, nil, fmt.Errorf("failed to record use of API token %s: %w", token.Id, err)
+	}
+
+	return user, token, nil
+}
+
+func apiTokenFromStmt(stmt *sqlite.Stmt) *model.ApiToken {
+	return &model.ApiToken{
+		Id:         model.NewIdentifier(stmt.GetInt64("id")),
+		UserId:     model.NewIdentifier(stmt.GetInt64("user_id")),
+		Name:       stmt.GetText("name"),
+		Scopes:     strings.Fields(stmt.GetText("scopes")),
+		CreatedAt:  stmt.GetText("created_at"),
+		LastUsedAt: stmt.GetText("last_used_at"),
+	}
+}
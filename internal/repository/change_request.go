@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"time"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var (
+	ErrNoSuchChangeRequest   = errors.New("change request does not exist")
+	ErrChangeRequestResolved = errors.New("change request has already been resolved")
+)
+
+// GetChangeRequests retrieves change requests with the given status, or all of them if status is empty,
+// oldest first.
+func (r *Repository) GetChangeRequests(status string) ([]*model.ChangeRequest, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, kind, status, title_id, title, from_service_id, to_service_id, reason, created_at, resolved_at
+FROM change_request
+WHERE $status IS NULL OR status = $status
+ORDER BY created_at, id
+;`,
+	)
+	defer stmt.Reset()
+	setNullableText(stmt, "$status", status)
+
+	changeRequests := make([]*model.ChangeRequest, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve change requests: %w", err)
+		} else if !hasRow {
+			break
+		}
+		changeRequest, err := changeRequestFromStmt(stmt)
+		if err != nil {
+			return nil, err
+		}
+		changeRequests = append(changeRequests, changeRequest)
+	}
+
+	return changeRequests, nil
+}
+
+func (r *Repository) GetChangeRequest(id model.Identifier) (*model.ChangeRequest, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, kind, status, title_id, title, from_service_id, to_service_id, reason, created_at, resolved_at
+FROM change_request
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", id.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve change request %s: %w", id, err)
+	} else if !hasRow {
+		return nil, ErrNoSuchChangeRequest
+	}
+
+	return changeRequestFromStmt(stmt)
+}
+
+// PutChangeRequest submits a new change request, or amends an existing one that is still pending.
+// The status and timestamps are managed by the repository and are ignored.
+func (r *Repository) PutChangeRequest(changeRequest *model.ChangeRequest) (changeRequestId model.Identifier, err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	if changeRequest.Id == model.NoId {
+		changeRequestId, err = r.insertChangeRequest(changeRequest)
+		return
+	}
+	changeRequestId = changeRequest.Id
+	err = r.updateChangeRequest(changeRequest)
+	return
+}
+
+func (r *Repository) insertChangeRequest(changeRequest *model.ChangeRequest) (model.Identifier, error) {
+	title, err := marshalChangeRequestTitle(changeRequest)
+	if err != nil {
+		return model.NoId, err
+	}
+
+	stmt := r.conn.Prep(`
+INSERT INTO change_request (
+	id,
+	user_id,
+	kind,
+	status,
+	title_id,
+	title,
+	from_service_id,
+	to_service_id,
+	reason,
+	created_at
+)
+VALUES (
+	$id,
+	$userId,
+	$kind,
+	$status,
+	$titleId,
+	$title,
+	$fromServiceId,
+	$toServiceId,
+	$reason,
+	$createdAt
+)
+;`,
+	)
+	defer stmt.Reset()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$userId", changeRequest.UserId.Int())
+	stmt.SetText("$kind", changeRequest.Kind)
+	stmt.SetText("$status", model.ChangeRequestPending)
+	setNullableInt64(stmt, "$titleId", changeRequest.TitleId.Int())
+	setNullableText(stmt, "$title", title)
+	setNullableInt64(stmt, "$fromServiceId", changeRequest.FromServiceId.Int())
+	setNullableInt64(stmt, "$toServiceId", changeRequest.ToServiceId.Int())
+	stmt.SetText("$reason", changeRequest.Reason)
+	stmt.SetText("$createdAt", createdAt)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		return model.NoId, err
+	}
+	changeRequest.Id = model.NewIdentifier(id)
+	changeRequest.Status = model.ChangeRequestPending
+	changeRequest.CreatedAt = createdAt
+	changeRequest.ResolvedAt = ""
+
+	return changeRequest.Id, nil
+}
+
+func (r *Repository) updateChangeRequest(changeRequest *model.ChangeRequest) error {
+	existing, err := r.GetChangeRequest(changeRequest.Id)
+	if err != nil {
+		return err
+	}
+	if existing.Status != model.ChangeRequestPending {
+		return ErrChangeRequestResolved
+	}
+	title, err := marshalChangeRequestTitle(changeRequest)
+	if err != nil {
+		return err
+	}
+
+	stmt := r.conn.Prep(`
+UPDATE change_request
+SET
+	kind = $kind,
+	title_id = $titleId,
+	title = $title,
+	from_service_id = $fromServiceId,
+	to_service_id = $toServiceId,
+	reason = $reason
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", changeRequest.Id.Int())
+	stmt.SetText("$kind", changeRequest.Kind)
+	setNullableInt64(stmt, "$titleId", changeRequest.TitleId.Int())
+	setNullableText(stmt, "$title", title)
+	setNullableInt64(stmt, "$fromServiceId", changeRequest.FromServiceId.Int())
+	setNullableInt64(stmt, "$toServiceId", changeRequest.ToServiceId.Int())
+	stmt.SetText("$reason", changeRequest.Reason)
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to update change request %s: %w", changeRequest.Id, err)
+	}
+	changeRequest.UserId = existing.UserId
+	changeRequest.Status = existing.Status
+	changeRequest.CreatedAt = existing.CreatedAt
+	changeRequest.ResolvedAt = existing.ResolvedAt
+	return nil
+}
+
+// ApproveChangeRequest applies a pending change request to the catalog and marks it approved.
+// Either the whole change is applied or none of it is.
+func (r *Repository) ApproveChangeRequest(id model.Identifier) (changeRequest *model.ChangeRequest, err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	changeRequest, err = r.GetChangeRequest(id)
+	if err != nil {
+		return
+	}
+	if changeRequest.Status != model.ChangeRequestPending {
+		return nil, ErrChangeRequestResolved
+	}
+
+	switch changeRequest.Kind {
+	case model.ChangeRequestAdd:
+		changeRequest.Title.Id = model.NoId
+		changeRequest.TitleId, err = r.PutTitle(changeRequest.Title)
+		if err == nil && changeRequest.ToServiceId != model.NoId {
+			err = r.PutServiceTitle(&model.ServiceTitle{
+				ServiceId: changeRequest.ToServiceId,
+				TitleId:   changeRequest.TitleId,
+			})
+		}
+	case model.ChangeRequestEdit:
+		changeRequest.Title.Id = changeRequest.TitleId
+		_, err = r.PutTitle(changeRequest.Title)
+	case model.ChangeRequestMove:
+		err = r.DeleteServiceTitle(changeRequest.FromServiceId, changeRequest.TitleId)
+		if err == nil {
+			err = r.PutServiceTitle(&model.ServiceTitle{
+				ServiceId: changeRequest.ToServiceId,
+				TitleId:   changeRequest.TitleId,
+			})
+		}
+	case model.ChangeRequestDelete:
+		if changeRequest.FromServiceId != model.NoId {
+			err = r.DeleteServiceTitle(changeRequest.FromServiceId, changeRequest.TitleId)
+		} else {
+			err = r.DeleteTitle(changeRequest.TitleId)
+		}
+	default:
+		err = fmt.Errorf("unknown change request kind `%s`", changeRequest.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.resolveChangeRequest(changeRequest, model.ChangeRequestApproved)
+	return
+}
+
+// RejectChangeRequest marks a pending change request rejected without applying it.
+func (r *Repository) RejectChangeRequest(id model.Identifier) (changeRequest *model.ChangeRequest, err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	changeRequest, err = r.GetChangeRequest(id)
+	if err != nil {
+		return
+	}
+	if changeRequest.Status != model.ChangeRequestPending {
+		return nil, ErrChangeRequestResolved
+	}
+	err = r.resolveChangeRequest(changeRequest, model.ChangeRequestRejected)
+	return
+}
+
+func (r *Repository) resolveChangeRequest(changeRequest *model.ChangeRequest, status string) error {
+	stmt := r.conn.Prep(`
+UPDATE change_request
+SET
+	status = $status,
+	title_id = $titleId,
+	resolved_at = $resolvedAt
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	resolvedAt := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$id", changeRequest.Id.Int())
+	stmt.SetText("$status", status)
+	setNullableInt64(stmt, "$titleId", changeRequest.TitleId.Int())
+	stmt.SetText("$resolvedAt", resolvedAt)
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to resolve change request %s: %w", changeRequest.Id, err)
+	}
+	changeRequest.Status = status
+	changeRequest.ResolvedAt = resolvedAt
+	return nil
+}
+
+// marshalChangeRequestTitle encodes the proposed title for storage, or returns an empty string if there is none.
+func marshalChangeRequestTitle(changeRequest *model.ChangeRequest) (string, error) {
+	if changeRequest.Title == nil {
+		return "", nil
+	}
+	title, err := json.Marshal(changeRequest.Title)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode proposed title: %w", err)
+	}
+	return string(title), nil
+}
+
+func changeRequestFromStmt(stmt *sqlite.Stmt) (*model.ChangeRequest, error) {
+	changeRequest := &model.ChangeRequest{
+		Id:            model.NewIdentifier(stmt.GetInt64("id")),
+		UserId:        model.NewIdentifier(stmt.GetInt64("user_id")),
+		Kind:          stmt.GetText("kind"),
+		Status:        stmt.GetText("status"),
+		TitleId:       model.NewIdentifier(stmt.GetInt64("title_id")),
+		FromServiceId: model.NewIdentifier(stmt.GetInt64("from_service_id")),
+		ToServiceId:   model.NewIdentifier(stmt.GetInt64("to_service_id")),
+		Reason:        stmt.GetText("reason"),
+		CreatedAt:     stmt.GetText("created_at"),
+		ResolvedAt:    stmt.GetText("resolved_at"),
+	}
+	if title := stmt.GetText("title"); title != "" {
+		if err := json.Unmarshal([]byte(title), &changeRequest.Title); err != nil {
+			return nil, fmt.Errorf("failed to decode proposed title for change request %s: %w", changeRequest.Id, err)
+		}
+	}
+	return changeRequest, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+)
+
+var ErrDuplicateCredit = errors.New("a person may only be credited once per role")
+
+// GetTitleCredits retrieves a title's credits, grouped by role and in billing order.
+func (r *Repository) GetTitleCredits(titleId model.TitleId) ([]*model.Credit, error) {
+	stmt := r.conn.Prep(`
+SELECT c.person_id, p.name, c.role, c.billing
+FROM title_credit c
+INNER JOIN person p ON p.id = c.person_id
+WHERE c.title_id = $titleId
+ORDER BY c.role, c.billing, p.name
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+
+	credits := make([]*model.Credit, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve credits for title %s: %w", titleId, err)
+		} else if !hasRow {
+			break
+		}
+		credits = append(credits, &model.Credit{
+			PersonId: model.NewIdentifier(stmt.GetInt64("person_id")),
+			Name:     stmt.GetText("name"),
+			Role:     stmt.GetText("role"),
+			Billing:  stmt.GetInt64("billing"),
+		})
+	}
+
+	return credits, nil
+}
+
+// setTitleCredits replaces a title's credits. Credits without a person ID are given to the person with
+// exactly the credit's name, who is added if there isn't one yet, and the person ID and name of each
+// credit are filled in from the catalog. Since credits given by name and by ID may turn out to be for the
+// same person, ErrDuplicateCredit is returned if anyone ends up credited twice in the same role.
+func (r *Repository) setTitleCredits(titleId model.TitleId, credits []*model.Credit) error {
+	deleteStmt := r.conn.Prep(`
+DELETE FROM title_credit
+WHERE title_id = $titleId
+;`,
+	)
+	defer deleteStmt.Reset()
+	deleteStmt.SetInt64("$titleId", titleId.Int())
+	if _, err := deleteStmt.Step(); err != nil {
+		return fmt.Errorf("failed to clear credits for title %s: %w", titleId, err)
+	}
+
+	stmt := r.conn.Prep(`
+INSERT INTO title_credit (title_id, person_id, role, billing)
+VALUES ($titleId, $personId, $role, $billing)
+;`,
+	)
+	type creditKey struct {
+		personId model.Identifier
+		role     string
+	}
+	credited := make(map[creditKey]bool)
+	for _, credit := range credits {
+		var err error
+		if credit.PersonId == model.NoId {
+			credit.PersonId, err = r.getOrInsertPerson(credit.Name)
+		} else {
+			var person *model.Person
+			person, err = r.GetPerson(credit.PersonId)
+			if err == nil {
+				credit.Name = person.Name
+			}
+		}
+		if err != nil {
+			return err
+		}
+		key := creditKey{credit.PersonId, credit.Role}
+		if credited[key] {
+			return ErrDuplicateCredit
+		}
+		credited[key] = true
+
+		stmt.SetInt64("$titleId", titleId.Int())
+		stmt.SetInt64("$personId", credit.PersonId.Int())
+		stmt.SetText("$role", credit.Role)
+		stmt.SetInt64("$billing", credit.Billing)
+		_, err = stmt.Step()
+		stmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to credit person %s on title %s: %w", credit.PersonId, titleId, err)
+		}
+	}
+	return nil
+}
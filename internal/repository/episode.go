@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var (
+	ErrNoSuchSeason  = errors.New("season does not exist")
+	ErrNoSuchEpisode = errors.New("episode does not exist")
+	ErrNotSeries     = errors.New("title is not a series")
+)
+
+// episodeStatsColumns selects how many episodes the title `t` has and their average runtime, leaving out
+// episodes whose runtime isn't known, for titleFromStmt to fill in.
+const episodeStatsColumns = `
+	(
+		SELECT count(*)
+		FROM season s
+		INNER JOIN episode e ON e.season_id = s.id
+		WHERE s.title_id = t.id
+	) AS episode_count,
+	(
+		SELECT round(avg(e.runtime))
+		FROM season s
+		INNER JOIN episode e ON e.season_id = s.id
+		WHERE s.title_id = t.id AND e.runtime > 0
+	) AS average_episode_runtime`
+
+// GetTitleSeasons retrieves a series' seasons in order, without their episodes.
+func (r *Repository) GetTitleSeasons(titleId model.TitleId) ([]*model.Season, error) {
+	stmt := r.conn.Prep(`
+SELECT s.id, s.title_id, s.number, s.name, s.air_date, count(e.id) AS episode_count
+FROM season s
+LEFT JOIN episode e ON e.season_id = s.id
+WHERE s.title_id = $titleId
+GROUP BY s.id
+ORDER BY s.number
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+
+	seasons := make([]*model.Season, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve seasons for title %s: %w", titleId, err)
+		} else if !hasRow {
+			break
+		}
+		seasons = append(seasons, &model.Season{
+			Id:           model.NewIdentifier(stmt.GetInt64("id")),
+			TitleId:      model.NewIdentifier(stmt.GetInt64("title_id")),
+			Number:       stmt.GetInt64("number"),
+			Name:         stmt.GetText("name"),
+			AirDate:      stmt.GetText("air_date"),
+			EpisodeCount: stmt.GetInt64("episode_count"),
+		})
+	}
+
+	return seasons, nil
+}
+
+// GetTitleEpisodes retrieves a series' episodes in order. If seasonNumber is not nil, only the episodes of
+// that season are included.
+func (r *Repository) GetTitleEpisodes(titleId model.TitleId, seasonNumber *int64) ([]*model.Episode, error) {
+	stmt := r.conn.Prep(`
+SELECT e.id, s.title_id, s.number AS season_number, e.number, e.name, e.air_date, e.runtime
+FROM episode e
+INNER JOIN season s ON s.id = e.season_id
+WHERE s.title_id = $titleId
+	AND ($seasonNumber IS NULL OR s.number = $seasonNumber)
+ORDER BY s.number, e.number
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+	if seasonNumber == nil {
+		stmt.SetNull("$seasonNumber")
+	} else {
+		stmt.SetInt64("$seasonNumber", *seasonNumber)
+	}
+
+	episodes := make([]*model.Episode, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve episodes for title %s: %w", titleId, err)
+		} else if !hasRow {
+			break
+		}
+		episodes = append(episodes, episodeFromStmt(stmt))
+	}
+
+	return episodes, nil
+}
+
+// GetEpisode retrieves an episode of any series.
+func (r *Repository) GetEpisode(episodeId model.Identifier) (*model.Episode, error) {
+	stmt := r.conn.Prep(`
+SELECT e.id, s.title_id, s.number AS season_number, e.number, e.name, e.air_date, e.runtime
+FROM episode e
+INNER JOIN season s ON s.id = e.season_id
+WHERE e.id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", episodeId.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve episode %s: %w", episodeId, err)
+	} else if !hasRow {
+		return nil, ErrNoSuchEpisode
+	}
+
+	return episodeFromStmt(stmt), nil
+}
+
+// PutSeason inserts or updates the season of a series with the season's number, replacing its episodes.
+// Episodes keep their IDs as long as their numbers don't change, and watch events for episodes that are
+// removed are deleted. The IDs of the season and its episodes are filled in.
+func (r *Repository) PutSeason(season *model.Season) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	title, err := r.GetTitle(season.TitleId)
+	if err != nil {
+		return err
+	}
+	if title.Type != model.TitleTypeSeries {
+		return ErrNotSeries
+	}
+
+	season.Id, err = r.getSeasonId(season.TitleId, season.Number)
+	if errors.Is(err, ErrNoSuchSeason) {
+		season.Id, err = r.insertSeason(season)
+	} else if err == nil {
+		err = r.updateSeason(season)
+	}
+	if err != nil {
+		return err
+	}
+
+	numbers := make([]int64, len(season.Episodes))
+	for i, episode := range season.Episodes {
+		numbers[i] = episode.Number
+	}
+	encodedNumbers, err := json.Marshal(numbers)
+	if err != nil {
+		return err
+	}
+	if err = r.deleteSeasonEpisodes(season.Id, string(encodedNumbers)); err != nil {
+		return err
+	}
+
+	stmt := r.conn.Prep(`
+INSERT INTO episode (
+	id,
+	season_id,
+	number,
+	name,
+	air_date,
+	runtime
+)
+VALUES (
+	$id,
+	$seasonId,
+	$number,
+	$name,
+	$airDate,
+	$runtime
+)
+ON CONFLICT (season_id, number) DO UPDATE SET
+	name = excluded.name,
+	air_date = excluded.air_date,
+	runtime = excluded.runtime
+;`,
+	)
+	idStmt := r.conn.Prep(`
+SELECT id
+FROM episode
+WHERE season_id = $seasonId AND number = $number
+;`,
+	)
+	for _, episode := range season.Episodes {
+		stmt.SetInt64("$seasonId", season.Id.Int())
+		stmt.SetInt64("$number", episode.Number)
+		stmt.SetText("$name", episode.Name)
+		stmt.SetText("$airDate", episode.AirDate)
+		stmt.SetInt64("$runtime", episode.Runtime)
+		_, err = sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+		stmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to save episode %d of season %d of title %s: %w", episode.Number, season.Number, season.TitleId, err)
+		}
+
+		// The episode may have kept the ID it had before, so look it up rather than trusting InsertRandID.
+		idStmt.SetInt64("$seasonId", season.Id.Int())
+		idStmt.SetInt64("$number", episode.Number)
+		_, err = idStmt.Step()
+		episode.Id = model.NewIdentifier(idStmt.GetInt64("id"))
+		idStmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve episode %d of season %d of title %s: %w", episode.Number, season.Number, season.TitleId, err)
+		}
+		episode.TitleId = season.TitleId
+		episode.SeasonNumber = season.Number
+	}
+	season.EpisodeCount = int64(len(season.Episodes))
+
+	return nil
+}
+
+// DeleteSeason deletes a season of a series along with its episodes and any watch events for them.
+func (r *Repository) DeleteSeason(titleId model.TitleId, number int64) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	seasonId, err := r.getSeasonId(titleId, number)
+	if err != nil {
+		return err
+	}
+	if err = r.deleteSeasonEpisodes(seasonId, "[]"); err != nil {
+		return err
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM season
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", seasonId.Int())
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete season %d of title %s: %w", number, titleId, err)
+	}
+	return nil
+}
+
+func (r *Repository) getSeasonId(titleId model.TitleId, number int64) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+SELECT id
+FROM season
+WHERE title_id = $titleId AND number = $number
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+	stmt.SetInt64("$number", number)
+	if hasRow, err := stmt.Step(); err != nil {
+		return model.NoId, fmt.Errorf("failed to retrieve season %d of title %s: %w", number, titleId, err)
+	} else if !hasRow {
+		return model.NoId, ErrNoSuchSeason
+	}
+	return model.NewIdentifier(stmt.GetInt64("id")), nil
+}
+
+func (r *Repository) insertSeason(season *model.Season) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+INSERT INTO season (
+	id,
+	title_id,
+	number,
+	name,
+	air_date
+)
+VALUES (
+	$id,
+	$titleId,
+	$number,
+	$name,
+	$airDate
+)
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", season.TitleId.Int())
+	stmt.SetInt64("$number", season.Number)
+	stmt.SetText("$name", season.Name)
+	stmt.SetText("$airDate", season.AirDate)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		return model.NoId, fmt.Errorf("failed to create season %d of title %s: %w", season.Number, season.TitleId, err)
+	}
+	return model.NewIdentifier(id), nil
+}
+
+func (r *Repository) updateSeason(season *model.Season) error {
+	stmt := r.conn.Prep(`
+UPDATE season
+SET name = $name, air_date = $airDate
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", season.Id.Int())
+	stmt.SetText("$name", season.Name)
+	stmt.SetText("$airDate", season.AirDate)
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to update season %d of title %s: %w", season.Number, season.TitleId, err)
+	}
+	return nil
+}
+
+// deleteSeasonEpisodes deletes a season's episodes whose numbers aren't in keepNumbers, a JSON array,
+// along with any watch events for them.
+func (r *Repository) deleteSeasonEpisodes(seasonId model.Identifier, keepNumbers string) error {
+	eventStmt := r.conn.Prep(`
+DELETE FROM watch_event
+WHERE episode_id IN (
+	SELECT id
+	FROM episode
+	WHERE season_id = $seasonId AND number NOT IN (SELECT value FROM json_each($keepNumbers))
+)
+;`,
+	)
+	defer eventStmt.Reset()
+	eventStmt.SetInt64("$seasonId", seasonId.Int())
+	eventStmt.SetText("$keepNumbers", keepNumbers)
+	if _, err := eventStmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete watch events for episodes of season %s: %w", seasonId, err)
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM episode
+WHERE season_id = $seasonId AND number NOT IN (SELECT value FROM json_each($keepNumbers))
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$seasonId", seasonId.Int())
+	stmt.SetText("$keepNumbers", keepNumbers)
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete episodes of season %s: %w", seasonId, err)
+	}
+	return nil
+}
+
+// deleteTitleSeasons deletes a series' seasons and episodes. Watch events for the episodes are left for
+// the caller to delete.
+func (r *Repository) deleteTitleSeasons(titleId model.TitleId) error {
+	episodeStmt := r.conn.Prep(`
+DELETE FROM episode
+WHERE season_id IN (SELECT id FROM season WHERE title_id = $titleId)
+;`,
+	)
+	defer episodeStmt.Reset()
+	episodeStmt.SetInt64("$titleId", titleId.Int())
+	if _, err := episodeStmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete episodes of title %s: %w", titleId, err)
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM season
+WHERE title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete seasons of title %s: %w", titleId, err)
+	}
+	return nil
+}
+
+func episodeFromStmt(stmt *sqlite.Stmt) *model.Episode {
+	return &model.Episode{
+		Id:           model.NewIdentifier(stmt.GetInt64("id")),
+		TitleId:      model.NewIdentifier(stmt.GetInt64("title_id")),
+		SeasonNumber: stmt.GetInt64("season_number"),
+		Number:       stmt.GetInt64("number"),
+		Name:         stmt.GetText("name"),
+		AirDate:      stmt.GetText("air_date"),
+		Runtime:      stmt.GetInt64("runtime"),
+	}
+}
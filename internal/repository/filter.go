@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/djcrock/fwip/internal/expr"
+	"github.com/djcrock/fwip/internal/model"
+	"strconv"
+	"strings"
+	"zombiezen.com/go/sqlite"
+)
+
+// The column compared by each numeric filter field. Zero means the value is unknown,
+// so titles with a zero value never match a comparison.
+var filterColumns = map[string]string{
+	expr.FieldYear:    `t.year`,
+	expr.FieldRuntime: `t.runtime`,
+	expr.FieldRating:  `t.imdb_rating`,
+}
+
+// A compiledFilter is a filter compiled to an SQL condition on titles aliased as `t`,
+// with its values bound to parameters named $filter0, $filter1 and so on.
+type compiledFilter struct {
+	sql  strings.Builder
+	args []any
+}
+
+// compileFilter compiles a parsed filter. Usernames must not be expr.Me.
+func compileFilter(node expr.Node) (*compiledFilter, error) {
+	f := &compiledFilter{}
+	if err := f.compile(node); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// param adds an argument, returning the name of the parameter to bind it to.
+func (f *compiledFilter) param(arg any) string {
+	f.args = append(f.args, arg)
+	return "$filter" + strconv.Itoa(len(f.args)-1)
+}
+
+// params adds several arguments, returning a comma-separated list of their parameters.
+func (f *compiledFilter) params(args []string) string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = f.param(arg)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *compiledFilter) compile(node expr.Node) error {
+	switch n := node.(type) {
+	case *expr.And:
+		f.sql.WriteString("(")
+		for i, term := range n.Terms {
+			if i > 0 {
+				f.sql.WriteString(" AND ")
+			}
+			if err := f.compile(term); err != nil {
+				return err
+			}
+		}
+		if len(n.Terms) == 0 {
+			f.sql.WriteString("TRUE")
+		}
+		f.sql.WriteString(")")
+	case *expr.Not:
+		f.sql.WriteString("NOT ")
+		return f.compile(n.Term)
+	case *expr.Compare:
+		column, ok := filterColumns[n.Field]
+		if !ok {
+			return fmt.Errorf("cannot compare field `%s`", n.Field)
+		}
+		op := string(n.Op)
+		if n.Op == expr.OpEq {
+			op = "="
+		}
+		fmt.Fprintf(&f.sql, "(%s > 0 AND %s %s %s)", column, column, op, f.param(n.Value))
+	case *expr.OneOf:
+		switch n.Field {
+		case expr.FieldType:
+			fmt.Fprintf(&f.sql, "t.type IN (%s)", f.params(n.Values))
+		case expr.FieldGenre:
+			fmt.Fprintf(&f.sql, `EXISTS (
+		SELECT 1
+		FROM title_genre tg
+		INNER JOIN genre g ON g.id = tg.genre_id
+		WHERE tg.title_id = t.id AND g.name IN (%s)
+	)`, f.params(n.Values))
+		case expr.FieldService:
+			// Services can be named without regard to case or spaces, like `amazonprime`, or given by ID.
+			keys := make([]string, len(n.Values))
+			ids := make([]string, 0, len(n.Values))
+			for i, value := range n.Values {
+				keys[i] = strings.ToLower(strings.ReplaceAll(value, " ", ""))
+				if id, err := model.IdentifierFromString(value); err == nil {
+					ids = append(ids, f.param(id.Int()))
+				}
+			}
+			fmt.Fprintf(&f.sql, `EXISTS (
+		SELECT 1
+		FROM service_title st
+		INNER JOIN service s ON s.id = st.service_id
+		WHERE st.title_id = t.id
+			AND (replace(lower(s.name), ' ', '') IN (%s) OR s.id IN (%s))
+			AND (st.available_from IS NULL OR st.available_from <= %s)
+			AND (st.available_until IS NULL OR st.available_until >= %[3]s)
+	)`, f.params(keys), strings.Join(ids, ", "), f.param(today()))
+		default:
+			return fmt.Errorf("cannot match field `%s`", n.Field)
+		}
+	case *expr.UserHas:
+		if n.Username == expr.Me {
+			return fmt.Errorf("filter refers to `%s` without a user", expr.Me)
+		}
+		condition := "wh.watched"
+		if n.Field == expr.FieldWants {
+			condition = "wh.want_to_watch > 0"
+		}
+		fmt.Fprintf(&f.sql, `EXISTS (
+		SELECT 1
+		FROM watch_history wh
+		INNER JOIN user u ON u.id = wh.user_id
+		WHERE wh.title_id = t.id AND u.username = %s AND %s
+	)`, f.param(n.Username), condition)
+	case *expr.Text:
+		fmt.Fprintf(
+			&f.sql,
+			"t.id IN (SELECT rowid FROM title_search WHERE title_search MATCH %s)",
+			f.param(matchQuery(strings.Join(n.Words, " "))),
+		)
+	default:
+		return fmt.Errorf("unknown filter term %T", node)
+	}
+	return nil
+}
+
+// bind binds the filter's arguments to a statement containing its SQL.
+func (f *compiledFilter) bind(stmt *sqlite.Stmt) {
+	for i, arg := range f.args {
+		param := "$filter" + strconv.Itoa(i)
+		switch arg := arg.(type) {
+		case string:
+			stmt.SetText(param, arg)
+		case int64:
+			stmt.SetInt64(param, arg)
+		case float64:
+			stmt.SetFloat(param, arg)
+		}
+	}
+}
+
+// prepareFiltered prepares a query containing the SQL of a compiled filter, binding the filter's arguments.
+// Filters can be written in endless ways, so the statement is only cached if there is no filter.
+// The returned function must be called once the statement is no longer needed.
+func (r *Repository) prepareFiltered(query string, filter *compiledFilter) (*sqlite.Stmt, func(), error) {
+	if filter == nil {
+		stmt := r.conn.Prep(query)
+		return stmt, func() { stmt.Reset() }, nil
+	}
+	stmt, err := r.conn.Prepare(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare filter: %w", err)
+	}
+	filter.bind(stmt)
+	return stmt, func() { stmt.Finalize() }, nil
+}
+
+// filterCondition compiles a filter to a condition to append to a WHERE clause,
+// or returns an empty condition if there is no filter.
+func filterCondition(node expr.Node) (string, *compiledFilter, error) {
+	if node == nil {
+		return "", nil, nil
+	}
+	compiled, err := compileFilter(node)
+	if err != nil {
+		return "", nil, err
+	}
+	return "\n\tAND " + compiled.sql.String(), compiled, nil
+}
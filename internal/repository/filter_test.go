@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"github.com/djcrock/fwip/internal/expr"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var filterParamPattern = regexp.MustCompile(`\$filter[0-9]+`)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		// values must be bound as arguments and must not appear in the SQL.
+		values []any
+	}{
+		{`type:movie`, []any{"movie"}},
+		{`year:>=1990 runtime:<110`, []any{float64(1990), float64(110)}},
+		{`rating:7.5`, []any{7.5}},
+		{`genre:"drama'); DROP TABLE title; --"`, []any{"drama'); DROP TABLE title; --"}},
+		{`service:"Amazon Prime",x9`, []any{"amazonprime", "x9", int64(1197)}},
+		{`-watched:"bob' OR '1'='1"`, []any{"bob' OR '1'='1"}},
+		{`wants:alice`, []any{"alice"}},
+		{`"robert'); DROP TABLE user; --" tables`, []any{`"robert');"* "DROP"* "TABLE"* "user;"* "--"* "tables"*`}},
+	}
+	for _, test := range tests {
+		node, err := expr.Parse(test.filter)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", test.filter, err)
+		}
+		compiled, err := compileFilter(node)
+		if err != nil {
+			t.Errorf("compileFilter(%q) returned error: %v", test.filter, err)
+			continue
+		}
+		sql := compiled.sql.String()
+		for _, value := range test.values {
+			if !slices.Contains(compiled.args, value) {
+				t.Errorf("compileFilter(%q) args = %#v, missing %#v", test.filter, compiled.args, value)
+			}
+			if s, ok := value.(string); ok && strings.Contains(sql, s) {
+				t.Errorf("compileFilter(%q) put %q in the SQL: %s", test.filter, s, sql)
+			}
+		}
+		if strings.Contains(sql, `"`) || strings.Contains(sql, "--") {
+			t.Errorf("compileFilter(%q) put part of the filter in the SQL: %s", test.filter, sql)
+		}
+		params := filterParamPattern.FindAllString(sql, -1)
+		seen := make(map[string]bool)
+		for _, param := range params {
+			seen[param] = true
+		}
+		if len(seen) != len(compiled.args) {
+			t.Errorf("compileFilter(%q) has %d parameters for %d args: %s", test.filter, len(seen), len(compiled.args), sql)
+		}
+	}
+}
+
+func TestCompileFilterRejectsMe(t *testing.T) {
+	node, err := expr.Parse("watched:me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := compileFilter(node); err == nil {
+		t.Error("compileFilter accepted a filter referring to `me`")
+	}
+}
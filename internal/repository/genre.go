@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+)
+
+// GetTitleGenres retrieves the names of a title's genres in alphabetical order.
+func (r *Repository) GetTitleGenres(titleId model.TitleId) ([]string, error) {
+	stmt := r.conn.Prep(`
+SELECT g.name
+FROM title_genre tg
+INNER JOIN genre g ON g.id = tg.genre_id
+WHERE tg.title_id = $titleId
+ORDER BY g.name
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+
+	genres := make([]string, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve genres for title %s: %w", titleId, err)
+		} else if !hasRow {
+			break
+		}
+		genres = append(genres, stmt.GetText("name"))
+	}
+
+	return genres, nil
+}
+
+// setTitleGenres replaces a title's genres, adding any genres that don't exist yet.
+func (r *Repository) setTitleGenres(titleId model.TitleId, genres []string) error {
+	deleteStmt := r.conn.Prep(`
+DELETE FROM title_genre
+WHERE title_id = $titleId
+;`,
+	)
+	defer deleteStmt.Reset()
+	deleteStmt.SetInt64("$titleId", titleId.Int())
+	if _, err := deleteStmt.Step(); err != nil {
+		return fmt.Errorf("failed to clear genres for title %s: %w", titleId, err)
+	}
+
+	genreStmt := r.conn.Prep(`
+INSERT INTO genre (name)
+VALUES ($name)
+ON CONFLICT (name) DO NOTHING
+;`,
+	)
+	titleGenreStmt := r.conn.Prep(`
+INSERT INTO title_genre (title_id, genre_id)
+SELECT $titleId, id
+FROM genre
+WHERE name = $name
+ON CONFLICT DO NOTHING
+;`,
+	)
+	for _, genre := range genres {
+		genreStmt.SetText("$name", genre)
+		_, err := genreStmt.Step()
+		genreStmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to add genre `%s`: %w", genre, err)
+		}
+
+		titleGenreStmt.SetInt64("$titleId", titleId.Int())
+		titleGenreStmt.SetText("$name", genre)
+		_, err = titleGenreStmt.Step()
+		titleGenreStmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to add genre `%s` to title %s: %w", genre, titleId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"time"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var (
+	ErrNoSuchList          = errors.New("list does not exist")
+	ErrNoSuchListItem      = errors.New("title is not on the list")
+	ErrNoSuchListMember    = errors.New("user is not a member of the list")
+	ErrDuplicateListItem   = errors.New("title is already on the list")
+	ErrDuplicateListMember = errors.New("user is already a member of the list")
+)
+
+// GetUserLists retrieves the lists the user owns or is a member of, in order of name.
+func (r *Repository) GetUserLists(userId model.UserId) ([]*model.List, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, name, description, created_at
+FROM list
+WHERE user_id = $userId
+	OR id IN (SELECT list_id FROM list_member WHERE user_id = $userId)
+ORDER BY name, id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+
+	lists := make([]*model.List, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve lists: %w", err)
+		} else if !hasRow {
+			break
+		}
+		lists = append(lists, listFromStmt(stmt))
+	}
+
+	for _, list := range lists {
+		var err error
+		list.MemberIds, err = r.getListMemberIds(list.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lists, nil
+}
+
+// GetList retrieves a list and its members, but not its items.
+func (r *Repository) GetList(listId model.Identifier) (*model.List, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, name, description, created_at
+FROM list
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", listId.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve list %s: %w", listId, err)
+	} else if !hasRow {
+		return nil, ErrNoSuchList
+	}
+	list := listFromStmt(stmt)
+
+	var err error
+	list.MemberIds, err = r.getListMemberIds(listId)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *Repository) getListMemberIds(listId model.Identifier) ([]model.UserId, error) {
+	stmt := r.conn.Prep(`
+SELECT user_id
+FROM list_member
+WHERE list_id = $listId
+ORDER BY user_id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+
+	memberIds := make([]model.UserId, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve members of list %s: %w", listId, err)
+		} else if !hasRow {
+			break
+		}
+		memberIds = append(memberIds, model.NewIdentifier(stmt.GetInt64("user_id")))
+	}
+	return memberIds, nil
+}
+
+// GetListItems retrieves a list's items and their titles in order.
+func (r *Repository) GetListItems(listId model.Identifier) ([]*model.ListItem, error) {
+	stmt := r.conn.Prep(`
+SELECT
+	li.position, li.added_by, li.added_at,
+	t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description
+FROM list_item li
+INNER JOIN title t ON t.id = li.title_id
+WHERE li.list_id = $listId
+ORDER BY li.position
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+
+	items := make([]*model.ListItem, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve items of list %s: %w", listId, err)
+		} else if !hasRow {
+			break
+		}
+		title := titleFromStmt(stmt)
+		items = append(items, &model.ListItem{
+			TitleId:  title.Id,
+			Position: stmt.GetInt64("position"),
+			AddedBy:  model.NewIdentifier(stmt.GetInt64("added_by")),
+			AddedAt:  stmt.GetText("added_at"),
+			Title:    title,
+		})
+	}
+	return items, nil
+}
+
+func (r *Repository) CreateList(list *model.List) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+INSERT INTO list (
+	id,
+	user_id,
+	name,
+	description,
+	created_at
+)
+VALUES (
+	$id,
+	$userId,
+	$name,
+	$description,
+	$createdAt
+)
+;`,
+	)
+	defer stmt.Reset()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$userId", list.UserId.Int())
+	stmt.SetText("$name", list.Name)
+	stmt.SetText("$description", list.Description)
+	stmt.SetText("$createdAt", createdAt)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		return model.NoId, fmt.Errorf("failed to create list: %w", err)
+	}
+	list.Id = model.NewIdentifier(id)
+	list.CreatedAt = createdAt
+	list.MemberIds = []model.UserId{}
+
+	return list.Id, nil
+}
+
+// DeleteList removes a list along with its items, members and share links.
+func (r *Repository) DeleteList(listId model.Identifier) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	for _, table := range []string{"list_item", "list_member", "share_link"} {
+		stmt := r.conn.Prep("DELETE FROM " + table + " WHERE list_id = $listId;")
+		stmt.SetInt64("$listId", listId.Int())
+		_, err = stmt.Step()
+		stmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to delete %s rows for list %s: %w", table, listId, err)
+		}
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM list
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", listId.Int())
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete list %s: %w", listId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchList
+	}
+	return nil
+}
+
+// AddListMember lets another user change a list's items.
+func (r *Repository) AddListMember(listId model.Identifier, userId model.UserId) error {
+	stmt := r.conn.Prep(`
+INSERT INTO list_member (list_id, user_id)
+VALUES ($listId, $userId)
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if _, err := stmt.Step(); err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintPrimaryKey {
+			return ErrDuplicateListMember
+		}
+		return fmt.Errorf("failed to add member %s to list %s: %w", userId, listId, err)
+	}
+	return nil
+}
+
+// RemoveListMember removes a member from a list, revoking any share links they made to it.
+func (r *Repository) RemoveListMember(listId model.Identifier, userId model.UserId) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+
+	stmt := r.conn.Prep(`
+DELETE FROM list_member
+WHERE list_id = $listId AND user_id = $userId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to remove member %s from list %s: %w", userId, listId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchListMember
+	}
+
+	// Links the member shared stop working once they can no longer see the list.
+	linkStmt := r.conn.Prep(`
+DELETE FROM share_link
+WHERE list_id = $listId AND user_id = $userId
+;`,
+	)
+	defer linkStmt.Reset()
+	linkStmt.SetInt64("$listId", listId.Int())
+	linkStmt.SetInt64("$userId", userId.Int())
+	if _, err = linkStmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete share links to list %s for member %s: %w", listId, userId, err)
+	}
+	return nil
+}
+
+// AddListItem adds a title to a list at the item's position, moving later items down to make room.
+// Positions past the end of the list add the title at the end. The item's position and added_at are filled in.
+func (r *Repository) AddListItem(listId model.Identifier, item *model.ListItem) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	if _, err = r.GetTitle(item.TitleId); err != nil {
+		return err
+	}
+	length, err := r.countListItems(listId)
+	if err != nil {
+		return err
+	}
+	item.Position = min(max(item.Position, 0), length)
+	if err = r.shiftListItems(listId, item.Position, length, 1); err != nil {
+		return err
+	}
+
+	stmt := r.conn.Prep(`
+INSERT INTO list_item (list_id, title_id, position, added_by, added_at)
+VALUES ($listId, $titleId, $position, $addedBy, $addedAt)
+;`,
+	)
+	defer stmt.Reset()
+	item.AddedAt = time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$titleId", item.TitleId.Int())
+	stmt.SetInt64("$position", item.Position)
+	stmt.SetInt64("$addedBy", item.AddedBy.Int())
+	stmt.SetText("$addedAt", item.AddedAt)
+	if _, err = stmt.Step(); err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintPrimaryKey {
+			return ErrDuplicateListItem
+		}
+		return fmt.Errorf("failed to add title %s to list %s: %w", item.TitleId, listId, err)
+	}
+	return nil
+}
+
+// RemoveListItem removes a title from a list, moving later items up to close the gap.
+func (r *Repository) RemoveListItem(listId model.Identifier, titleId model.TitleId) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	position, err := r.getListItemPosition(listId, titleId)
+	if err != nil {
+		return err
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM list_item
+WHERE list_id = $listId AND title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to remove title %s from list %s: %w", titleId, listId, err)
+	}
+	// Shift everything after the removed item, however long the list is.
+	return r.shiftListItems(listId, position+1, maxId, -1)
+}
+
+// MoveListItem moves a title to a new position in a list, shifting the items in between.
+// Positions past the end of the list move the title to the end. It returns the title's new position.
+func (r *Repository) MoveListItem(listId model.Identifier, titleId model.TitleId, to int64) (position int64, err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	from, err := r.getListItemPosition(listId, titleId)
+	if err != nil {
+		return 0, err
+	}
+	length, err := r.countListItems(listId)
+	if err != nil {
+		return 0, err
+	}
+	to = min(max(to, 0), length-1)
+	switch {
+	case to < from:
+		err = r.shiftListItems(listId, to, from, 1)
+	case to > from:
+		err = r.shiftListItems(listId, from+1, to+1, -1)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := r.conn.Prep(`
+UPDATE list_item
+SET position = $position
+WHERE list_id = $listId AND title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	stmt.SetInt64("$position", to)
+	if _, err = stmt.Step(); err != nil {
+		return 0, fmt.Errorf("failed to move title %s in list %s: %w", titleId, listId, err)
+	}
+	return to, nil
+}
+
+// removeTitleFromLists removes a title from every list it's on.
+func (r *Repository) removeTitleFromLists(titleId model.TitleId) error {
+	stmt := r.conn.Prep(`
+SELECT list_id
+FROM list_item
+WHERE title_id = $titleId
+;`,
+	)
+	var listIds []model.Identifier
+	stmt.SetInt64("$titleId", titleId.Int())
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			stmt.Reset()
+			return fmt.Errorf("failed to retrieve lists with title %s: %w", titleId, err)
+		} else if !hasRow {
+			break
+		}
+		listIds = append(listIds, model.NewIdentifier(stmt.GetInt64("list_id")))
+	}
+	stmt.Reset()
+
+	for _, listId := range listIds {
+		if err := r.RemoveListItem(listId, titleId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) getListItemPosition(listId model.Identifier, titleId model.TitleId) (int64, error) {
+	stmt := r.conn.Prep(`
+SELECT position
+FROM list_item
+WHERE list_id = $listId AND title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return 0, fmt.Errorf("failed to retrieve title %s in list %s: %w", titleId, listId, err)
+	} else if !hasRow {
+		return 0, ErrNoSuchListItem
+	}
+	return stmt.GetInt64("position"), nil
+}
+
+func (r *Repository) countListItems(listId model.Identifier) (int64, error) {
+	stmt := r.conn.Prep(`
+SELECT count(*) AS length
+FROM list_item
+WHERE list_id = $listId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return 0, fmt.Errorf("failed to count items of list %s: %w", listId, err)
+	}
+	return stmt.GetInt64("length"), nil
+}
+
+// shiftListItems adds delta to the positions of the items in [from, to).
+func (r *Repository) shiftListItems(listId model.Identifier, from int64, to int64, delta int64) error {
+	stmt := r.conn.Prep(`
+UPDATE list_item
+SET position = position + $delta
+WHERE list_id = $listId AND position >= $from AND position < $to
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$listId", listId.Int())
+	stmt.SetInt64("$from", from)
+	stmt.SetInt64("$to", to)
+	stmt.SetInt64("$delta", delta)
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to reorder list %s: %w", listId, err)
+	}
+	return nil
+}
+
+func listFromStmt(stmt *sqlite.Stmt) *model.List {
+	return &model.List{
+		Id:          model.NewIdentifier(stmt.GetInt64("id")),
+		UserId:      model.NewIdentifier(stmt.GetInt64("user_id")),
+		Name:        stmt.GetText("name"),
+		Description: stmt.GetText("description"),
+		CreatedAt:   stmt.GetText("created_at"),
+	}
+}
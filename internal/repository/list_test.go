@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"reflect"
+	"testing"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// newTestRepository opens a repository on a fresh in-memory database.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	dbPool, err := sqlitex.NewPool("file::memory:", sqlitex.PoolOptions{PoolSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewPool(dbPool)
+	repo := pool.GetRepository(context.Background())
+	t.Cleanup(func() {
+		pool.PutRepository(repo)
+		dbPool.Close()
+	})
+	return repo
+}
+
+// newTestList creates a list holding the titles in order.
+func newTestList(t *testing.T, repo *Repository, userId model.UserId, titleIds []model.TitleId) model.Identifier {
+	t.Helper()
+	listId, err := repo.CreateList(&model.List{UserId: userId, Name: "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, titleId := range titleIds {
+		item := &model.ListItem{TitleId: titleId, Position: int64(i), AddedBy: userId}
+		if err = repo.AddListItem(listId, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return listId
+}
+
+// listOrder returns the indexes into titleIds of a list's items in order, checking that their positions
+// run from zero without gaps.
+func listOrder(t *testing.T, repo *Repository, listId model.Identifier, titleIds []model.TitleId) []int {
+	t.Helper()
+	items, err := repo.GetListItems(listId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make([]int, len(items))
+	for i, item := range items {
+		if item.Position != int64(i) {
+			t.Errorf("item %d has position %d", i, item.Position)
+		}
+		order[i] = -1
+		for j, titleId := range titleIds {
+			if item.TitleId == titleId {
+				order[i] = j
+			}
+		}
+	}
+	return order
+}
+
+// newTestTitles creates a user and n movies.
+func newTestTitles(t *testing.T, repo *Repository, n int) (model.UserId, []model.TitleId) {
+	t.Helper()
+	userId, err := repo.PutUser(&model.User{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	titleIds := make([]model.TitleId, n)
+	for i := range titleIds {
+		titleIds[i], err = repo.PutTitle(&model.Title{
+			ImdbId: fmt.Sprintf("tt%07d", i+1),
+			Type:   model.TitleTypeMovie,
+			Name:   fmt.Sprintf("Title %d", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userId, titleIds
+}
+
+func TestMoveListItem(t *testing.T) {
+	tests := []struct {
+		item         int
+		to           int64
+		wantPosition int64
+		want         []int
+	}{
+		{item: 0, to: 2, wantPosition: 2, want: []int{1, 2, 0, 3}},
+		{item: 3, to: 0, wantPosition: 0, want: []int{3, 0, 1, 2}},
+		{item: 1, to: 3, wantPosition: 3, want: []int{0, 2, 3, 1}},
+		{item: 2, to: 1, wantPosition: 1, want: []int{0, 2, 1, 3}},
+		{item: 1, to: 1, wantPosition: 1, want: []int{0, 1, 2, 3}},
+		// Positions past either end of the list are clamped to it.
+		{item: 0, to: 4, wantPosition: 3, want: []int{1, 2, 3, 0}},
+		{item: 1, to: 100, wantPosition: 3, want: []int{0, 2, 3, 1}},
+		{item: 3, to: 3, wantPosition: 3, want: []int{0, 1, 2, 3}},
+		{item: 2, to: -5, wantPosition: 0, want: []int{2, 0, 1, 3}},
+	}
+	repo := newTestRepository(t)
+	userId, titleIds := newTestTitles(t, repo, 4)
+	for _, test := range tests {
+		listId := newTestList(t, repo, userId, titleIds)
+		position, err := repo.MoveListItem(listId, titleIds[test.item], test.to)
+		if err != nil {
+			t.Fatalf("MoveListItem(%d, %d) returned error: %v", test.item, test.to, err)
+		}
+		if position != test.wantPosition {
+			t.Errorf("MoveListItem(%d, %d) = %d, want %d", test.item, test.to, position, test.wantPosition)
+		}
+		if got := listOrder(t, repo, listId, titleIds); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MoveListItem(%d, %d) left %v, want %v", test.item, test.to, got, test.want)
+		}
+	}
+}
+
+func TestAddListItem(t *testing.T) {
+	tests := []struct {
+		to           int64
+		wantPosition int64
+		want         []int
+	}{
+		{to: 0, wantPosition: 0, want: []int{3, 0, 1, 2}},
+		{to: 2, wantPosition: 2, want: []int{0, 1, 3, 2}},
+		{to: 3, wantPosition: 3, want: []int{0, 1, 2, 3}},
+		{to: 10, wantPosition: 3, want: []int{0, 1, 2, 3}},
+		{to: -1, wantPosition: 0, want: []int{3, 0, 1, 2}},
+	}
+	repo := newTestRepository(t)
+	userId, titleIds := newTestTitles(t, repo, 4)
+	for _, test := range tests {
+		listId := newTestList(t, repo, userId, titleIds[:3])
+		item := &model.ListItem{TitleId: titleIds[3], Position: test.to, AddedBy: userId}
+		if err := repo.AddListItem(listId, item); err != nil {
+			t.Fatalf("AddListItem at %d returned error: %v", test.to, err)
+		}
+		if item.Position != test.wantPosition {
+			t.Errorf("AddListItem at %d added at %d, want %d", test.to, item.Position, test.wantPosition)
+		}
+		if got := listOrder(t, repo, listId, titleIds); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("AddListItem at %d left %v, want %v", test.to, got, test.want)
+		}
+	}
+}
+
+func TestRemoveListItem(t *testing.T) {
+	tests := []struct {
+		item int
+		want []int
+	}{
+		{item: 0, want: []int{1, 2}},
+		{item: 1, want: []int{0, 2}},
+		{item: 2, want: []int{0, 1}},
+	}
+	repo := newTestRepository(t)
+	userId, titleIds := newTestTitles(t, repo, 3)
+	for _, test := range tests {
+		listId := newTestList(t, repo, userId, titleIds)
+		if err := repo.RemoveListItem(listId, titleIds[test.item]); err != nil {
+			t.Fatalf("RemoveListItem(%d) returned error: %v", test.item, err)
+		}
+		if got := listOrder(t, repo, listId, titleIds); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RemoveListItem(%d) left %v, want %v", test.item, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE title ADD COLUMN imdb_rating REAL NOT NULL DEFAULT 0;
+ALTER TABLE title ADD COLUMN imdb_votes INTEGER NOT NULL DEFAULT 0;
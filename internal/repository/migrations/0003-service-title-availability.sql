@@ -0,0 +1,5 @@
+-- Dates are stored as YYYY-MM-DD. A NULL bound means the window is open on that end.
+ALTER TABLE service_title ADD COLUMN available_from TEXT;
+ALTER TABLE service_title ADD COLUMN available_until TEXT;
+
+CREATE INDEX ix_service_title__service_id__available_until ON service_title(service_id, available_until);
@@ -0,0 +1,7 @@
+-- When a title was last added to a user's want-to-watch list, as an RFC 3339 timestamp.
+ALTER TABLE watch_history ADD COLUMN wanted_since TEXT;
+
+UPDATE watch_history SET wanted_since = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE want_to_watch > 0;
+
+-- The name of the pick strategy to use when a request doesn't specify one.
+ALTER TABLE user ADD COLUMN pick_strategy TEXT;
@@ -0,0 +1,21 @@
+-- Catalog changes proposed by users, awaiting moderation. See model.ChangeRequest for how the columns
+-- are used by each kind of change. title_id deliberately has no foreign key so that the history of
+-- approved deletions is kept.
+CREATE TABLE change_request (
+    id              INTEGER PRIMARY KEY,
+    user_id         INTEGER NOT NULL,
+    kind            TEXT    NOT NULL,
+    status          TEXT    NOT NULL,
+    title_id        INTEGER,
+    title           TEXT,
+    from_service_id INTEGER,
+    to_service_id   INTEGER,
+    reason          TEXT    NOT NULL,
+    created_at      TEXT    NOT NULL,
+    resolved_at     TEXT,
+    FOREIGN KEY (user_id) REFERENCES user(id),
+    FOREIGN KEY (from_service_id) REFERENCES service(id),
+    FOREIGN KEY (to_service_id) REFERENCES service(id)
+) STRICT;
+
+CREATE INDEX ix_change_request__status__created_at ON change_request(status, created_at);
@@ -0,0 +1,13 @@
+-- An argon2id hash in the PHC string format. Users without one can't log in.
+ALTER TABLE user ADD COLUMN password_hash TEXT;
+
+-- Sessions are looked up by a hash of the token in the user's cookie, so the tokens themselves are never stored.
+CREATE TABLE session (
+    token_hash TEXT    PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    created_at TEXT    NOT NULL,
+    expires_at TEXT    NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user(id)
+) STRICT, WITHOUT ROWID;
+
+CREATE INDEX ix_session__user_id ON session(user_id);
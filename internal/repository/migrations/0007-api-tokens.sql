@@ -0,0 +1,15 @@
+-- Like sessions, API tokens are looked up by a hash so the tokens themselves are never stored.
+-- scopes is a space-separated list; an empty list means the token is unrestricted.
+CREATE TABLE api_token (
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER NOT NULL,
+    name         TEXT    NOT NULL,
+    token_hash   TEXT    NOT NULL,
+    scopes       TEXT    NOT NULL,
+    created_at   TEXT    NOT NULL,
+    last_used_at TEXT,
+    FOREIGN KEY (user_id) REFERENCES user(id)
+) STRICT;
+
+CREATE UNIQUE INDEX uix_api_token__token_hash ON api_token(token_hash);
+CREATE INDEX ix_api_token__user_id ON api_token(user_id);
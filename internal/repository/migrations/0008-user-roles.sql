@@ -0,0 +1,2 @@
+-- Either 'admin' or 'member'. Promote the first admin with `fwip user role <username> admin`.
+ALTER TABLE user ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
@@ -0,0 +1,38 @@
+ALTER TABLE title ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- Genre names are matched case-insensitively, so that `horror` finds titles imported as `Horror`.
+CREATE TABLE genre (
+    id   INTEGER PRIMARY KEY,
+    name TEXT NOT NULL COLLATE NOCASE
+) STRICT;
+
+CREATE UNIQUE INDEX uix_genre__name ON genre(name);
+
+CREATE TABLE title_genre (
+    title_id INTEGER NOT NULL,
+    genre_id INTEGER NOT NULL,
+    FOREIGN KEY (title_id) REFERENCES title(id),
+    FOREIGN KEY (genre_id) REFERENCES genre(id),
+    PRIMARY KEY (title_id, genre_id)
+) STRICT, WITHOUT ROWID;
+
+CREATE INDEX ix_title_genre__genre_id__title_id ON title_genre(genre_id, title_id);
+
+CREATE TABLE person (
+    id   INTEGER PRIMARY KEY,
+    name TEXT NOT NULL
+) STRICT;
+
+-- A person may be credited with several roles on the same title, such as writer and director.
+-- Credits are listed in ascending billing order within each role.
+CREATE TABLE title_credit (
+    title_id  INTEGER NOT NULL,
+    person_id INTEGER NOT NULL,
+    role      TEXT    NOT NULL,
+    billing   INTEGER NOT NULL,
+    FOREIGN KEY (title_id) REFERENCES title(id),
+    FOREIGN KEY (person_id) REFERENCES person(id),
+    PRIMARY KEY (title_id, person_id, role)
+) STRICT, WITHOUT ROWID;
+
+CREATE INDEX ix_title_credit__person_id__title_id ON title_credit(person_id, title_id);
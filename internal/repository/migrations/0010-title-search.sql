@@ -0,0 +1,22 @@
+-- Full-text index of title names, kept in sync with the title table by triggers.
+CREATE VIRTUAL TABLE title_search USING fts5(
+    name,
+    content = 'title',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO title_search (title_search) VALUES ('rebuild');
+
+CREATE TRIGGER tr_title__insert__title_search AFTER INSERT ON title BEGIN
+    INSERT INTO title_search (rowid, name) VALUES (new.id, new.name);
+END;
+
+CREATE TRIGGER tr_title__delete__title_search AFTER DELETE ON title BEGIN
+    INSERT INTO title_search (title_search, rowid, name) VALUES ('delete', old.id, old.name);
+END;
+
+CREATE TRIGGER tr_title__update__title_search AFTER UPDATE OF id, name ON title BEGIN
+    INSERT INTO title_search (title_search, rowid, name) VALUES ('delete', old.id, old.name);
+    INSERT INTO title_search (rowid, name) VALUES (new.id, new.name);
+END;
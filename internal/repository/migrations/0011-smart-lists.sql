@@ -0,0 +1,11 @@
+-- Saved filters, written in the language parsed by package expr, that are evaluated whenever they're used.
+CREATE TABLE smart_list (
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    name       TEXT    NOT NULL,
+    filter     TEXT    NOT NULL,
+    created_at TEXT    NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user(id)
+) STRICT;
+
+CREATE UNIQUE INDEX uix_smart_list__user_id__name ON smart_list(user_id, name);
@@ -0,0 +1,38 @@
+-- Lists of titles curated by their owner and any members they add.
+CREATE TABLE list (
+    id          INTEGER PRIMARY KEY,
+    user_id     INTEGER NOT NULL,
+    name        TEXT    NOT NULL,
+    description TEXT    NOT NULL,
+    created_at  TEXT    NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user(id)
+) STRICT;
+
+CREATE INDEX ix_list__user_id ON list(user_id);
+
+CREATE TABLE list_member (
+    list_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    FOREIGN KEY (list_id) REFERENCES list(id),
+    FOREIGN KEY (user_id) REFERENCES user(id),
+    PRIMARY KEY (list_id, user_id)
+) STRICT, WITHOUT ROWID;
+
+CREATE INDEX ix_list_member__user_id ON list_member(user_id);
+
+-- Positions run from zero without gaps. They aren't unique, since reordering shifts
+-- several items one row at a time.
+CREATE TABLE list_item (
+    list_id  INTEGER NOT NULL,
+    title_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    added_by INTEGER NOT NULL,
+    added_at TEXT    NOT NULL,
+    FOREIGN KEY (list_id) REFERENCES list(id),
+    FOREIGN KEY (title_id) REFERENCES title(id),
+    FOREIGN KEY (added_by) REFERENCES user(id),
+    PRIMARY KEY (list_id, title_id)
+) STRICT, WITHOUT ROWID;
+
+CREATE INDEX ix_list_item__list_id__position ON list_item(list_id, position);
+CREATE INDEX ix_list_item__title_id ON list_item(title_id);
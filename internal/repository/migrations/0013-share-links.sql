@@ -0,0 +1,16 @@
+-- Links that let anyone with the token see a list, or what a user has watched or wants to watch.
+-- list_id is only set for links to a list.
+CREATE TABLE share_link (
+    id         INTEGER PRIMARY KEY,
+    token      TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL,
+    kind       TEXT    NOT NULL,
+    list_id    INTEGER,
+    created_at TEXT    NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user(id),
+    FOREIGN KEY (list_id) REFERENCES list(id)
+) STRICT;
+
+CREATE UNIQUE INDEX uix_share_link__token ON share_link(token);
+CREATE INDEX ix_share_link__user_id ON share_link(user_id);
+CREATE INDEX ix_share_link__list_id ON share_link(list_id);
@@ -0,0 +1,42 @@
+-- Each time a user watched a title, or one episode of it. watch_history.watched is no longer set directly:
+-- the triggers below keep it true while the user has an event for the whole title (one without an episode).
+CREATE TABLE watch_event (
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    title_id   INTEGER NOT NULL,
+    watched_at TEXT    NOT NULL,
+    episode_id INTEGER,
+    rating     REAL,
+    source     TEXT    NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user(id),
+    FOREIGN KEY (title_id) REFERENCES title(id)
+) STRICT;
+
+CREATE INDEX ix_watch_event__user_id__watched_at ON watch_event(user_id, watched_at);
+CREATE INDEX ix_watch_event__title_id ON watch_event(title_id);
+
+-- When titles already marked as watched were watched isn't known, so they're recorded as watched now.
+INSERT INTO watch_event (user_id, title_id, watched_at, source)
+SELECT user_id, title_id, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), 'watch_history'
+FROM watch_history
+WHERE watched;
+
+CREATE TRIGGER tr_watch_event__insert AFTER INSERT ON watch_event
+WHEN new.episode_id IS NULL
+BEGIN
+    INSERT INTO watch_history (user_id, title_id, watched, want_to_watch)
+    VALUES (new.user_id, new.title_id, 1, 0)
+    ON CONFLICT DO UPDATE SET watched = 1;
+END;
+
+CREATE TRIGGER tr_watch_event__delete AFTER DELETE ON watch_event
+WHEN old.episode_id IS NULL
+BEGIN
+    UPDATE watch_history
+    SET watched = EXISTS (
+        SELECT 1
+        FROM watch_event
+        WHERE user_id = old.user_id AND title_id = old.title_id AND episode_id IS NULL
+    )
+    WHERE user_id = old.user_id AND title_id = old.title_id;
+END;
@@ -0,0 +1,24 @@
+-- The seasons of a series and their episodes. Season 0 holds specials. An empty air_date or a zero runtime
+-- means it isn't known.
+CREATE TABLE season (
+    id       INTEGER PRIMARY KEY,
+    title_id INTEGER NOT NULL,
+    number   INTEGER NOT NULL,
+    name     TEXT    NOT NULL,
+    air_date TEXT    NOT NULL,
+    FOREIGN KEY (title_id) REFERENCES title(id)
+) STRICT;
+
+CREATE UNIQUE INDEX uix_season__title_id__number ON season(title_id, number);
+
+CREATE TABLE episode (
+    id        INTEGER PRIMARY KEY,
+    season_id INTEGER NOT NULL,
+    number    INTEGER NOT NULL,
+    name      TEXT    NOT NULL,
+    air_date  TEXT    NOT NULL,
+    runtime   INTEGER NOT NULL,
+    FOREIGN KEY (season_id) REFERENCES season(id)
+) STRICT;
+
+CREATE UNIQUE INDEX uix_episode__season_id__number ON episode(season_id, number);
@@ -0,0 +1,17 @@
+-- Series the user has only watched some episodes of belong in their watch history too, so that their
+-- progress can be shown alongside everything else.
+INSERT INTO watch_history (user_id, title_id, watched, want_to_watch)
+SELECT DISTINCT user_id, title_id, 0, 0
+FROM watch_event
+WHERE episode_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+CREATE TRIGGER tr_watch_event__insert_episode AFTER INSERT ON watch_event
+WHEN new.episode_id IS NOT NULL
+BEGIN
+    INSERT INTO watch_history (user_id, title_id, watched, want_to_watch)
+    VALUES (new.user_id, new.title_id, 0, 0)
+    ON CONFLICT DO NOTHING;
+END;
+
+CREATE INDEX ix_watch_event__user_id__episode_id ON watch_event(user_id, episode_id) WHERE episode_id IS NOT NULL;
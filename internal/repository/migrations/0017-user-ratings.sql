@@ -0,0 +1,15 @@
+-- What each user thinks of a title overall, as opposed to watch_event.rating, which is for one viewing.
+CREATE TABLE user_rating (
+    user_id    INTEGER NOT NULL,
+    title_id   INTEGER NOT NULL,
+    rating     REAL    NOT NULL,
+    review     TEXT    NOT NULL,
+    created_at TEXT    NOT NULL,
+    updated_at TEXT    NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user(id),
+    FOREIGN KEY (title_id) REFERENCES title(id),
+    PRIMARY KEY (user_id, title_id)
+) STRICT, WITHOUT ROWID;
+
+CREATE INDEX ix_user_rating__title_id ON user_rating(title_id);
+CREATE INDEX ix_user_rating__user_id__updated_at ON user_rating(user_id, updated_at);
@@ -0,0 +1,2 @@
+-- Credits given by name are matched to an existing person with exactly that name.
+CREATE INDEX ix_person__name ON person(name);
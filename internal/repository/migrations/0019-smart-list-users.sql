@@ -0,0 +1,11 @@
+-- The users each smart list's filter names, by the username they had when the list was saved, so that
+-- renaming a user doesn't change which titles the list matches. Lists saved before this have no rows, and
+-- their usernames are looked up whenever they're used.
+CREATE TABLE smart_list_user (
+    smart_list_id INTEGER NOT NULL,
+    username      TEXT    NOT NULL,
+    user_id       INTEGER NOT NULL,
+    FOREIGN KEY (smart_list_id) REFERENCES smart_list(id),
+    FOREIGN KEY (user_id) REFERENCES user(id),
+    PRIMARY KEY (smart_list_id, username)
+) STRICT, WITHOUT ROWID;
@@ -0,0 +1,5 @@
+-- Links to a list stop working when whoever made them is no longer its owner or a member.
+DELETE FROM share_link
+WHERE list_id IS NOT NULL
+    AND user_id NOT IN (SELECT user_id FROM list WHERE id = share_link.list_id)
+    AND user_id NOT IN (SELECT user_id FROM list_member WHERE list_id = share_link.list_id);
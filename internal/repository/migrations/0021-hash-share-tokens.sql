@@ -0,0 +1,8 @@
+-- Share tokens are stored hashed, like session and API tokens, so that a leaked database can't be used to see
+-- what users have shared. hash_token is provided by the repository while migrations run.
+UPDATE share_link SET token = hash_token(token);
+
+ALTER TABLE share_link RENAME COLUMN token TO token_hash;
+
+DROP INDEX uix_share_link__token;
+CREATE UNIQUE INDEX uix_share_link__token_hash ON share_link(token_hash);
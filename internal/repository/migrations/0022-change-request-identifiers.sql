@@ -0,0 +1,17 @@
+-- Proposed titles saved before IDs were encoded in base36 have numeric IDs, which no longer decode.
+UPDATE change_request
+SET title = json_set(title, '$.id', format_id(json_extract(title, '$.id')))
+WHERE title != '' AND json_type(title, '$.id') = 'integer';
+
+UPDATE change_request
+SET title = json_set(title, '$.credits', (
+    SELECT json_group_array(
+        CASE
+            WHEN json_type(c.value, '$.person_id') = 'integer'
+                THEN json_set(c.value, '$.person_id', format_id(json_extract(c.value, '$.person_id')))
+            ELSE json(c.value)
+        END
+    )
+    FROM json_each(change_request.title, '$.credits') c
+))
+WHERE title != '' AND json_type(title, '$.credits') = 'array';
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"zombiezen.com/go/sqlite"
+)
+
+var (
+	ErrMalformedCursor = errors.New("malformed cursor")
+	ErrCursorMismatch  = errors.New("cursor belongs to a differently sorted list")
+)
+
+// A Page selects part of a list. Lists are paged with cursors rather than offsets, so that pages
+// don't skip or repeat items when the list changes between requests.
+type Page struct {
+	// Limit is the greatest number of items to return.
+	Limit int
+	// After is the cursor returned with the previous page, or nil for the first page.
+	After *Cursor
+}
+
+// A Cursor marks the position of the last item in a page, in terms of the value the list is sorted by
+// and the ID that breaks ties between items with the same value.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v,omitempty"`
+	Id    int64  `json:"i,string"`
+}
+
+// String encodes the cursor as an opaque token to hand to clients.
+func (c *Cursor) String() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// ParseCursor decodes a token produced by Cursor.String.
+func ParseCursor(token string) (*Cursor, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrMalformedCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var cursor Cursor
+	if err = decoder.Decode(&cursor); err != nil {
+		return nil, ErrMalformedCursor
+	}
+	switch value := cursor.Value.(type) {
+	case nil, string:
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			cursor.Value = i
+		} else if f, err := value.Float64(); err == nil {
+			cursor.Value = f
+		} else {
+			return nil, ErrMalformedCursor
+		}
+	default:
+		return nil, ErrMalformedCursor
+	}
+	return &cursor, nil
+}
+
+// checkCursor returns an error if the page's cursor came from a list with a different sort.
+func (p Page) checkCursor(sort string) error {
+	if p.After != nil && p.After.Sort != sort {
+		return ErrCursorMismatch
+	}
+	return nil
+}
+
+// bindCursor binds the page's cursor to the $cursorId parameter and, for lists sorted by something other
+// than their IDs, the $cursorValue parameter. They are bound to NULL for the first page.
+func (p Page) bindCursor(stmt *sqlite.Stmt) {
+	hasValue := false
+	for i := 1; i <= stmt.BindParamCount(); i++ {
+		hasValue = hasValue || stmt.BindParamName(i) == "$cursorValue"
+	}
+	if p.After == nil {
+		if hasValue {
+			stmt.SetNull("$cursorValue")
+		}
+		stmt.SetNull("$cursorId")
+		return
+	}
+	stmt.SetInt64("$cursorId", p.After.Id)
+	if !hasValue {
+		return
+	}
+	switch value := p.After.Value.(type) {
+	case int64:
+		stmt.SetInt64("$cursorValue", value)
+	case float64:
+		stmt.SetFloat("$cursorValue", value)
+	case string:
+		stmt.SetText("$cursorValue", value)
+	default:
+		stmt.SetNull("$cursorValue")
+	}
+}
+
+// cursorFromStmt makes a cursor for the current row of a statement that selects the value it is sorted
+// by as sort_value, if any, and the ID breaking ties as cursor_id.
+func cursorFromStmt(stmt *sqlite.Stmt, sort string) *Cursor {
+	cursor := &Cursor{Sort: sort, Id: stmt.GetInt64("cursor_id")}
+	if col := stmt.ColumnIndex("sort_value"); col >= 0 {
+		switch stmt.ColumnType(col) {
+		case sqlite.TypeInteger:
+			cursor.Value = stmt.ColumnInt64(col)
+		case sqlite.TypeFloat:
+			cursor.Value = stmt.ColumnFloat(col)
+		case sqlite.TypeText:
+			cursor.Value = stmt.ColumnText(col)
+		}
+	}
+	return cursor
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var ErrNoSuchPerson = errors.New("person does not exist")
+
+// SearchPeople retrieves a page of the people whose names contain query, ignoring case, in alphabetical order.
+// An empty query matches everybody.
+func (r *Repository) SearchPeople(query string, page Page) ([]*model.Person, *Cursor, error) {
+	if err := page.checkCursor("name"); err != nil {
+		return nil, nil, err
+	}
+	stmt := r.conn.Prep(`
+SELECT id, name, name AS sort_value, id AS cursor_id
+FROM person
+WHERE instr(lower(name), lower($query)) > 0
+	AND ($cursorId IS NULL OR (name, id) > ($cursorValue, $cursorId))
+ORDER BY name, id
+LIMIT $limit
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$query", query)
+	page.bindCursor(stmt)
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
+
+	people := make([]*model.Person, 0)
+	var last, next *Cursor
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, nil, fmt.Errorf("failed to search people: %w", err)
+		} else if !hasRow {
+			break
+		}
+		if len(people) == page.Limit {
+			next = last
+			break
+		}
+		people = append(people, &model.Person{
+			Id:   model.NewIdentifier(stmt.GetInt64("id")),
+			Name: stmt.GetText("name"),
+		})
+		last = cursorFromStmt(stmt, "name")
+	}
+
+	return people, next, nil
+}
+
+func (r *Repository) GetPerson(personId model.Identifier) (*model.Person, error) {
+	stmt := r.conn.Prep(`
+SELECT id, name
+FROM person
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", personId.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve person %s: %w", personId, err)
+	} else if !hasRow {
+		return nil, ErrNoSuchPerson
+	}
+
+	return &model.Person{
+		Id:   model.NewIdentifier(stmt.GetInt64("id")),
+		Name: stmt.GetText("name"),
+	}, nil
+}
+
+// GetPersonCredits retrieves a page of a person's filmography, newest titles first. A title's credits are
+// ordered by role, so a cursor holds the role and title ID of the last credit, and the title's year is looked
+// up from its ID.
+func (r *Repository) GetPersonCredits(personId model.Identifier, page Page) ([]*model.PersonCredit, *Cursor, error) {
+	if err := page.checkCursor("-year"); err != nil {
+		return nil, nil, err
+	}
+	stmt := r.conn.Prep(`
+SELECT
+	c.role, c.billing,
+	t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description,
+	c.role AS sort_value, t.id AS cursor_id
+FROM title_credit c
+INNER JOIN title t ON t.id = c.title_id
+WHERE c.person_id = $personId
+	AND ($cursorId IS NULL
+		OR (t.year, t.id) < ((SELECT year FROM title WHERE id = $cursorId), $cursorId)
+		OR (t.id = $cursorId AND c.role > $cursorValue))
+ORDER BY t.year DESC, t.id DESC, c.role
+LIMIT $limit
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$personId", personId.Int())
+	page.bindCursor(stmt)
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
+
+	credits := make([]*model.PersonCredit, 0)
+	var last, next *Cursor
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve credits for person %s: %w", personId, err)
+		} else if !hasRow {
+			break
+		}
+		if len(credits) == page.Limit {
+			next = last
+			break
+		}
+		credits = append(credits, &model.PersonCredit{
+			Role:    stmt.GetText("role"),
+			Billing: stmt.GetInt64("billing"),
+			Title:   titleFromStmt(stmt),
+		})
+		last = cursorFromStmt(stmt, "-year")
+	}
+
+	return credits, next, nil
+}
+
+// getOrInsertPerson finds the person with exactly the given name, adding them if there isn't one. If several
+// people share the name, the one with the lowest ID is used.
+func (r *Repository) getOrInsertPerson(name string) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+SELECT id
+FROM person
+WHERE name = $name
+ORDER BY id
+LIMIT 1
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$name", name)
+	if hasRow, err := stmt.Step(); err != nil {
+		return model.NoId, fmt.Errorf("failed to retrieve person `%s`: %w", name, err)
+	} else if hasRow {
+		return model.NewIdentifier(stmt.GetInt64("id")), nil
+	}
+	stmt.Reset()
+
+	return r.insertPerson(name)
+}
+
+func (r *Repository) insertPerson(name string) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+INSERT INTO person (id, name)
+VALUES ($id, $name)
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$name", name)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+	if err != nil {
+		return model.NoId, fmt.Errorf("failed to add person `%s`: %w", name, err)
+	}
+	return model.NewIdentifier(id), nil
+}
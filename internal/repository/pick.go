@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/expr"
+	"github.com/djcrock/fwip/internal/model"
+)
+
+var ErrNoCandidates = errors.New("no titles match the criteria")
+
+// PickCriteria restricts the titles that may be picked for a group of one or more users.
+// Zero values leave the corresponding restriction off.
+type PickCriteria struct {
+	UserIds    []model.UserId
+	ServiceId  model.ServiceId
+	Type       string
+	MaxRuntime int64
+	// Expr restricts the candidates to titles matching a filter, such as a smart list's.
+	Expr expr.Node
+}
+
+// PickTitle picks a title none of the users have watched from those matching the criteria, choosing the
+// first in the given order. Only the picked title is ever loaded.
+//
+// The order is an SQL ORDER BY clause over the candidates, which are titles aliased as `t` along with the
+// users' combined watch history for them as `wh`, with columns watched, want_to_watch and wanted_since.
+// It may use the $today and $serviceId parameters. It is written into the query, so it must never come
+// from a request.
+func (r *Repository) PickTitle(criteria PickCriteria, order string) (*model.Title, error) {
+	if len(criteria.UserIds) == 0 {
+		return nil, errors.New("cannot pick a title without any users")
+	}
+	exprCondition, compiled, err := filterCondition(criteria.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The users' watch histories are combined into one row per title before the candidates are considered.
+	stmt, done, err := r.prepareFiltered(`
+WITH wh AS (
+	SELECT
+		title_id,
+		max(watched) AS watched,
+		sum(max(want_to_watch, 0)) AS want_to_watch,
+		min(CASE WHEN want_to_watch > 0 THEN wanted_since END) AS wanted_since
+	FROM watch_history
+	WHERE user_id IN (SELECT value FROM json_each($userIds))
+	GROUP BY title_id
+)
+SELECT t.id
+FROM title t
+LEFT JOIN wh ON wh.title_id = t.id
+WHERE (wh.watched IS NULL OR NOT wh.watched)
+	AND ($type IS NULL OR t.type = $type)
+	AND ($maxRuntime IS NULL OR t.runtime BETWEEN 1 AND $maxRuntime)
+	AND ($serviceId IS NULL OR EXISTS (
+		SELECT 1
+		FROM service_title st
+		WHERE st.title_id = t.id
+			AND st.service_id = $serviceId
+			AND (st.available_from IS NULL OR st.available_from <= $today)
+			AND (st.available_until IS NULL OR st.available_until >= $today)
+	))`+exprCondition+`
+ORDER BY `+order+`
+LIMIT 1
+;`,
+		compiled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	stmt.SetText("$userIds", idArray(criteria.UserIds))
+	stmt.SetText("$today", today())
+	setNullableText(stmt, "$type", criteria.Type)
+	setNullableInt64(stmt, "$maxRuntime", criteria.MaxRuntime)
+	setNullableInt64(stmt, "$serviceId", criteria.ServiceId.Int())
+
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to pick title: %w", err)
+	} else if !hasRow {
+		return nil, ErrNoCandidates
+	}
+
+	// The episode and rating stats are only worked out for the title that was picked.
+	return r.GetTitle(model.NewIdentifier(stmt.GetInt64("id")))
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"sort"
+	"time"
+)
+
+// MarkEpisodeWatched records that the user watched an episode now, unless they already have.
+// The episode is returned.
+func (r *Repository) MarkEpisodeWatched(userId model.UserId, episodeId model.Identifier) (*model.Episode, error) {
+	episode, err := r.GetEpisode(episodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := r.conn.Prep(`
+SELECT EXISTS (
+	SELECT 1
+	FROM watch_event
+	WHERE user_id = $userId AND episode_id = $episodeId
+) AS watched
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetInt64("$episodeId", episodeId.Int())
+	if _, err = stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve watch events for episode %s: %w", episodeId, err)
+	}
+	if stmt.GetBool("watched") {
+		return episode, nil
+	}
+	stmt.Reset()
+
+	_, err = r.CreateWatchEvent(&model.WatchEvent{
+		UserId:    userId,
+		TitleId:   episode.TitleId,
+		WatchedAt: time.Now().UTC().Format(time.RFC3339),
+		EpisodeId: episodeId,
+		Source:    model.WatchSourceManual,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return episode, nil
+}
+
+// UnmarkEpisodeWatched deletes the user's watch events for an episode.
+func (r *Repository) UnmarkEpisodeWatched(userId model.UserId, episodeId model.Identifier) error {
+	if _, err := r.GetEpisode(episodeId); err != nil {
+		return err
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM watch_event
+WHERE user_id = $userId AND episode_id = $episodeId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetInt64("$episodeId", episodeId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete watch events for episode %s: %w", episodeId, err)
+	}
+	return nil
+}
+
+// GetUserNextUp finds the next episode of each series the user is part way through, the series they
+// watched most recently first. The next episode is the first one after the furthest episode the user has
+// watched, so episodes they skipped don't hold them back. Specials and episodes that haven't aired yet
+// are left out, and series without any episodes left aren't included.
+func (r *Repository) GetUserNextUp(userId model.UserId) ([]*model.NextUp, error) {
+	stmt := r.conn.Prep(`
+SELECT
+	e.id, s.title_id, s.number AS season_number, e.number, e.name, e.air_date, e.runtime,
+	(
+		SELECT max(watched_at)
+		FROM watch_event
+		WHERE user_id = $userId AND episode_id = e.id
+	) AS watched_at
+FROM episode e
+INNER JOIN season s ON s.id = e.season_id
+WHERE s.number > 0
+	AND (e.air_date = '' OR e.air_date <= $today)
+	AND s.title_id IN (
+		SELECT title_id
+		FROM watch_event
+		WHERE user_id = $userId AND episode_id IS NOT NULL
+	)
+ORDER BY s.title_id, s.number, e.number
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetText("$today", today())
+
+	// The episodes of each series come out together and in order, so each series is finished with as soon
+	// as the next one starts.
+	nextUps := make([]*model.NextUp, 0)
+	var left [][]*model.Episode
+	var episodes []*model.Episode
+	var watchedAt []string
+	finishSeries := func() {
+		seriesLeft, lastWatchedAt := episodesLeft(episodes, watchedAt)
+		if lastWatchedAt != "" && len(seriesLeft) > 0 {
+			nextUps = append(nextUps, &model.NextUp{
+				Episode:       seriesLeft[0],
+				EpisodesLeft:  int64(len(seriesLeft)),
+				LastWatchedAt: lastWatchedAt,
+			})
+			left = append(left, seriesLeft)
+		}
+		episodes, watchedAt = nil, nil
+	}
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve next up for user %s: %w", userId, err)
+		} else if !hasRow {
+			break
+		}
+		episode := episodeFromStmt(stmt)
+		if len(episodes) > 0 && episodes[0].TitleId != episode.TitleId {
+			finishSeries()
+		}
+		episodes = append(episodes, episode)
+		watchedAt = append(watchedAt, stmt.GetText("watched_at"))
+	}
+	finishSeries()
+	stmt.Reset()
+
+	for i, nextUp := range nextUps {
+		title, err := r.GetTitle(nextUp.Episode.TitleId)
+		if err != nil {
+			return nil, err
+		}
+		nextUp.Title = title
+		nextUp.RuntimeLeft = model.TotalRuntime(left[i], title.AverageEpisodeRuntime)
+	}
+	sort.SliceStable(nextUps, func(i, j int) bool {
+		return nextUps[i].LastWatchedAt > nextUps[j].LastWatchedAt
+	})
+
+	return nextUps, nil
+}
+
+// GetUserEpisodesLeft retrieves the episodes of a series after the furthest one the user has watched, in
+// order, or all of them if the user hasn't watched any. Specials are left out, but episodes that haven't
+// aired yet are included.
+func (r *Repository) GetUserEpisodesLeft(userId model.UserId, titleId model.TitleId) ([]*model.Episode, error) {
+	stmt := r.conn.Prep(`
+SELECT
+	e.id, s.title_id, s.number AS season_number, e.number, e.name, e.air_date, e.runtime,
+	(
+		SELECT max(watched_at)
+		FROM watch_event
+		WHERE user_id = $userId AND episode_id = e.id
+	) AS watched_at
+FROM episode e
+INNER JOIN season s ON s.id = e.season_id
+WHERE s.title_id = $titleId AND s.number > 0
+ORDER BY s.number, e.number
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+
+	episodes := make([]*model.Episode, 0)
+	watchedAt := make([]string, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve episodes left of title %s for user %s: %w", titleId, userId, err)
+		} else if !hasRow {
+			break
+		}
+		episodes = append(episodes, episodeFromStmt(stmt))
+		watchedAt = append(watchedAt, stmt.GetText("watched_at"))
+	}
+
+	left, _ := episodesLeft(episodes, watchedAt)
+	return left, nil
+}
+
+// episodesLeft finds the episodes after the furthest one the user has watched, given a series' episodes in
+// order and when the user last watched each one, which is empty for those they haven't watched. It also
+// returns when the user last watched any of them.
+func episodesLeft(episodes []*model.Episode, watchedAt []string) ([]*model.Episode, string) {
+	furthest := -1
+	lastWatchedAt := ""
+	for i := range episodes {
+		if watchedAt[i] != "" {
+			furthest = i
+			lastWatchedAt = max(lastWatchedAt, watchedAt[i])
+		}
+	}
+	return episodes[furthest+1:], lastWatchedAt
+}
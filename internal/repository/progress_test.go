@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"github.com/djcrock/fwip/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestEpisodesLeft(t *testing.T) {
+	tests := []struct {
+		name      string
+		watchedAt []string
+		// want lists the numbers of the episodes left.
+		want              []int64
+		wantLastWatchedAt string
+	}{
+		{
+			name:      "nothing watched",
+			watchedAt: []string{"", "", ""},
+			want:      []int64{1, 2, 3},
+		},
+		{
+			name:              "everything watched",
+			watchedAt:         []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+			want:              []int64{},
+			wantLastWatchedAt: "2024-01-03",
+		},
+		{
+			name:              "last episode watched",
+			watchedAt:         []string{"", "", "2024-01-01"},
+			want:              []int64{},
+			wantLastWatchedAt: "2024-01-01",
+		},
+		{
+			name:              "first episode watched",
+			watchedAt:         []string{"2024-01-01", "", ""},
+			want:              []int64{2, 3},
+			wantLastWatchedAt: "2024-01-01",
+		},
+		{
+			name:              "skipped episodes don't hold the user back",
+			watchedAt:         []string{"2024-01-01", "", "2024-01-02", "", ""},
+			want:              []int64{4, 5},
+			wantLastWatchedAt: "2024-01-02",
+		},
+		{
+			name:              "rewatching an earlier episode",
+			watchedAt:         []string{"", "2024-02-01", "", "2024-01-01", ""},
+			want:              []int64{5},
+			wantLastWatchedAt: "2024-02-01",
+		},
+		{
+			name:      "no episodes",
+			watchedAt: []string{},
+			want:      []int64{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			episodes := make([]*model.Episode, len(test.watchedAt))
+			for i := range episodes {
+				episodes[i] = &model.Episode{Number: int64(i + 1)}
+			}
+			left, lastWatchedAt := episodesLeft(episodes, test.watchedAt)
+			got := make([]int64, len(left))
+			for i, episode := range left {
+				got[i] = episode.Number
+			}
+			if !reflect.DeepEqual(got, test.want) || lastWatchedAt != test.wantLastWatchedAt {
+				t.Errorf("episodesLeft = %v, %q; want %v, %q", got, lastWatchedAt, test.want, test.wantLastWatchedAt)
+			}
+		})
+	}
+}
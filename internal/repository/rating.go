@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"time"
+	"zombiezen.com/go/sqlite"
+)
+
+var ErrNoSuchRating = errors.New("rating does not exist")
+
+// ratingStatsColumns selects the average of users' ratings of the title `t` and how many there are, for
+// titleFromStmt to fill in.
+const ratingStatsColumns = `
+	(
+		SELECT round(avg(rating), 2)
+		FROM user_rating
+		WHERE title_id = t.id
+	) AS user_rating,
+	(
+		SELECT count(*)
+		FROM user_rating
+		WHERE title_id = t.id
+	) AS user_rating_count`
+
+// GetUserRatings retrieves a page of the user's ratings, the most recently changed first.
+func (r *Repository) GetUserRatings(userId model.UserId, page Page) ([]*model.Rating, *Cursor, error) {
+	if err := page.checkCursor("-updated_at"); err != nil {
+		return nil, nil, err
+	}
+	stmt := r.conn.Prep(`
+SELECT user_id, title_id, rating, review, created_at, updated_at, updated_at AS sort_value, title_id AS cursor_id
+FROM user_rating
+WHERE user_id = $userId
+	AND ($cursorId IS NULL OR (updated_at, title_id) < ($cursorValue, $cursorId))
+ORDER BY updated_at DESC, title_id DESC
+LIMIT $limit
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	page.bindCursor(stmt)
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
+
+	ratings := make([]*model.Rating, 0)
+	var last, next *Cursor
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve ratings: %w", err)
+		} else if !hasRow {
+			break
+		}
+		if len(ratings) == page.Limit {
+			next = last
+			break
+		}
+		ratings = append(ratings, ratingFromStmt(stmt))
+		last = cursorFromStmt(stmt, "-updated_at")
+	}
+
+	return ratings, next, nil
+}
+
+// PutRating saves the user's rating of a title, replacing any rating they gave it before.
+// The timestamps are filled in.
+func (r *Repository) PutRating(rating *model.Rating) error {
+	if _, err := r.GetTitle(rating.TitleId); err != nil {
+		return err
+	}
+	stmt := r.conn.Prep(`
+INSERT INTO user_rating (
+	user_id,
+	title_id,
+	rating,
+	review,
+	created_at,
+	updated_at
+)
+VALUES (
+	$userId,
+	$titleId,
+	$rating,
+	$review,
+	$now,
+	$now
+)
+ON CONFLICT DO UPDATE SET
+	rating = excluded.rating,
+	review = excluded.review,
+	updated_at = excluded.updated_at
+RETURNING created_at, updated_at
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", rating.UserId.Int())
+	stmt.SetInt64("$titleId", rating.TitleId.Int())
+	stmt.SetFloat("$rating", rating.Rating)
+	stmt.SetText("$review", rating.Review)
+	stmt.SetText("$now", time.Now().UTC().Format(time.RFC3339))
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to save rating of title %s: %w", rating.TitleId, err)
+	}
+	rating.CreatedAt = stmt.GetText("created_at")
+	rating.UpdatedAt = stmt.GetText("updated_at")
+
+	return nil
+}
+
+// DeleteRating deletes the user's rating of a title.
+func (r *Repository) DeleteRating(userId model.UserId, titleId model.TitleId) error {
+	stmt := r.conn.Prep(`
+DELETE FROM user_rating
+WHERE user_id = $userId AND title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete rating of title %s: %w", titleId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchRating
+	}
+	return nil
+}
+
+func ratingFromStmt(stmt *sqlite.Stmt) *model.Rating {
+	return &model.Rating{
+		UserId:    model.NewIdentifier(stmt.GetInt64("user_id")),
+		TitleId:   model.NewIdentifier(stmt.GetInt64("title_id")),
+		Rating:    stmt.GetFloat("rating"),
+		Review:    stmt.GetText("review"),
+		CreatedAt: stmt.GetText("created_at"),
+		UpdatedAt: stmt.GetText("updated_at"),
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"github.com/djcrock/fwip/internal/auth"
+	"github.com/djcrock/fwip/internal/expr"
 	"github.com/djcrock/fwip/internal/model"
 	"io"
 	"io/fs"
 	"log"
 	"math"
 	"strconv"
+	"strings"
+	"time"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
@@ -19,9 +23,12 @@ import (
 var migrations embed.FS
 
 var (
-	ErrNoSuchTitle   = errors.New("title does not exist")
-	ErrNoSuchService = errors.New("service does not exist")
-	ErrNoSuchUser    = errors.New("user does not exist")
+	ErrNoSuchTitle        = errors.New("title does not exist")
+	ErrNoSuchService      = errors.New("service does not exist")
+	ErrNoSuchUser         = errors.New("user does not exist")
+	ErrDuplicateTitle     = errors.New("a title with that IMDb ID already exists")
+	ErrNoSuchServiceTitle = errors.New("title is not available on service")
+	ErrDuplicateUser      = errors.New("a user with that username already exists")
 )
 
 // A Repository is a Repository stores persisted state in an SQLite database.
@@ -76,107 +83,193 @@ func (r *Repository) Transact() (completeFn func(*error)) {
 	return sqlitex.Save(r.conn)
 }
 
-func (r *Repository) GetTitles() ([]*model.Title, error) {
-	stmt := r.conn.Prep(`
-SELECT id, imdb_id, type, name, year, release_date, runtime
-FROM title
-;`,
-	)
-	defer stmt.Reset()
+// TitleFilter narrows the titles returned by GetTitles. Zero values match every title.
+type TitleFilter struct {
+	// ServiceIds matches titles currently available on any of the services.
+	ServiceIds []model.ServiceId
+	// Genre matches titles with the genre, ignoring case.
+	Genre string
+	// Query matches titles with a word in their name starting with each word of the query.
+	Query string
+	// Expr matches titles matching a filter written in the expr mini-language.
+	Expr       expr.Node
+	Type       string
+	YearMin    int64
+	YearMax    int64
+	RuntimeMax int64
+}
 
-	titles := make([]*model.Title, 0)
-	for {
-		if hasRow, err := stmt.Step(); err != nil {
-			return nil, fmt.Errorf("failed to retrieve titles: %w", err)
-		} else if !hasRow {
-			break
-		}
-		titles = append(titles, &model.Title{
-			Id:          stmt.GetInt64("id"),
-			ImdbId:      stmt.GetText("imdb_id"),
-			Type:        stmt.GetText("type"),
-			Name:        stmt.GetText("name"),
-			Year:        stmt.GetInt64("year"),
-			ReleaseDate: stmt.GetText("release_date"),
-			Runtime:     stmt.GetInt64("runtime"),
-		})
-	}
+const (
+	TitleSortName        = "name"
+	TitleSortYear        = "year"
+	TitleSortReleaseDate = "release_date"
+	TitleSortRuntime     = "runtime"
+	// TitleSortRelevance lists the best matches for TitleFilter.Query first.
+	TitleSortRelevance = "relevance"
+)
 
-	return titles, nil
+// The expression titles are ordered by for each sort.
+var titleSortColumns = map[string]string{
+	TitleSortName:        `t.name`,
+	TitleSortYear:        `t.year`,
+	TitleSortReleaseDate: `t.release_date`,
+	TitleSortRuntime:     `t.runtime`,
+	TitleSortRelevance:   `m.rank`,
 }
 
-func (r *Repository) GetTitlesByService(serviceId int64) ([]*model.Title, error) {
-	stmt := r.conn.Prep(`
-SELECT t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime
+// TitleSort orders the titles returned by GetTitles. Titles with the same value are ordered by ID.
+type TitleSort struct {
+	Key        string
+	Descending bool
+}
+
+func (s TitleSort) String() string {
+	if s.Descending {
+		return "-" + s.Key
+	}
+	return s.Key
+}
+
+// GetTitles retrieves a page of the titles matching the filter, along with a cursor for the next page if
+// there is one.
+func (r *Repository) GetTitles(filter TitleFilter, sort TitleSort, page Page) ([]*model.Title, *Cursor, error) {
+	sortColumn, ok := titleSortColumns[sort.Key]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown title sort `%s`", sort.Key)
+	}
+	if sort.Key == TitleSortRelevance && matchQuery(filter.Query) == "" {
+		return nil, nil, errors.New("cannot sort titles by relevance without a query")
+	}
+	if err := page.checkCursor(sort.String()); err != nil {
+		return nil, nil, err
+	}
+	direction, comparison := "ASC", ">"
+	if sort.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	exprCondition, compiled, err := filterCondition(filter.Expr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+SELECT
+	t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description,
+	` + sortColumn + ` AS sort_value,
+	t.id AS cursor_id
 FROM title t
-INNER JOIN main.service_title st on t.id = st.title_id
-WHERE st.service_id = $serviceId
-;`,
-	)
-	defer stmt.Reset()
-	stmt.SetInt64("$serviceId", serviceId)
+LEFT JOIN (
+	SELECT rowid AS title_id, bm25(title_search) AS rank
+	FROM title_search
+	WHERE $query IS NOT NULL AND title_search MATCH $query
+) m ON m.title_id = t.id
+WHERE ($query IS NULL OR m.title_id IS NOT NULL)
+	AND ($serviceIds IS NULL OR EXISTS (
+		SELECT 1
+		FROM service_title st
+		WHERE st.title_id = t.id
+			AND st.service_id IN (SELECT value FROM json_each($serviceIds))
+			AND (st.available_from IS NULL OR st.available_from <= $today)
+			AND (st.available_until IS NULL OR st.available_until >= $today)
+	))
+	AND ($genre IS NULL OR EXISTS (
+		SELECT 1
+		FROM title_genre tg
+		INNER JOIN genre g ON g.id = tg.genre_id
+		WHERE tg.title_id = t.id AND g.name = $genre
+	))
+	AND ($type IS NULL OR t.type = $type)
+	AND ($yearMin IS NULL OR t.year >= $yearMin)
+	AND ($yearMax IS NULL OR t.year <= $yearMax)
+	AND ($runtimeMax IS NULL OR t.runtime BETWEEN 1 AND $runtimeMax)
+	AND ($cursorId IS NULL OR (` + sortColumn + `, t.id) ` + comparison + ` ($cursorValue, $cursorId))` + exprCondition + `
+ORDER BY ` + sortColumn + ` ` + direction + `, t.id ` + direction + `
+LIMIT $limit
+;`
+	stmt, done, err := r.prepareFiltered(query, compiled)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+	if len(filter.ServiceIds) > 0 {
+		stmt.SetText("$serviceIds", idArray(filter.ServiceIds))
+	} else {
+		stmt.SetNull("$serviceIds")
+	}
+	setNullableText(stmt, "$genre", filter.Genre)
+	setNullableText(stmt, "$query", matchQuery(filter.Query))
+	setNullableText(stmt, "$type", filter.Type)
+	setNullableInt64(stmt, "$yearMin", filter.YearMin)
+	setNullableInt64(stmt, "$yearMax", filter.YearMax)
+	setNullableInt64(stmt, "$runtimeMax", filter.RuntimeMax)
+	stmt.SetText("$today", today())
+	page.bindCursor(stmt)
+	// Fetch one more title than needed to find out whether there is another page.
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
 
 	titles := make([]*model.Title, 0)
+	var last, next *Cursor
 	for {
 		if hasRow, err := stmt.Step(); err != nil {
-			return nil, fmt.Errorf("failed to retrieve titles: %w", err)
+			return nil, nil, fmt.Errorf("failed to retrieve titles: %w", err)
 		} else if !hasRow {
 			break
 		}
-		titles = append(titles, &model.Title{
-			Id:          stmt.GetInt64("id"),
-			ImdbId:      stmt.GetText("imdb_id"),
-			Type:        stmt.GetText("type"),
-			Name:        stmt.GetText("name"),
-			Year:        stmt.GetInt64("year"),
-			ReleaseDate: stmt.GetText("release_date"),
-			Runtime:     stmt.GetInt64("runtime"),
-		})
+		if len(titles) == page.Limit {
+			next = last
+			break
+		}
+		titles = append(titles, titleFromStmt(stmt))
+		last = cursorFromStmt(stmt, sort.String())
 	}
 
-	return titles, nil
+	return titles, next, nil
 }
 
-func (r *Repository) GetTitle(titleId int64) (*model.Title, error) {
+func (r *Repository) GetTitle(titleId model.TitleId) (*model.Title, error) {
 	stmt := r.conn.Prep(`
-SELECT id, imdb_id, type, name, year, release_date, runtime
-FROM title
-WHERE id = $id
+SELECT t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description,` +
+		episodeStatsColumns + `,` + ratingStatsColumns + `
+FROM title t
+WHERE t.id = $id
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$id", titleId)
+	stmt.SetInt64("$id", titleId.Int())
 	if hasRow, err := stmt.Step(); err != nil {
-		return nil, fmt.Errorf("failed to retrieve title %d: %w", titleId, err)
+		return nil, fmt.Errorf("failed to retrieve title %s: %w", titleId, err)
 	} else if !hasRow {
 		return nil, ErrNoSuchTitle
 	}
 
-	title := &model.Title{
-		Id:          stmt.GetInt64("id"),
-		ImdbId:      stmt.GetText("imdb_id"),
-		Type:        stmt.GetText("type"),
-		Name:        stmt.GetText("name"),
-		Year:        stmt.GetInt64("year"),
-		ReleaseDate: stmt.GetText("release_date"),
-		Runtime:     stmt.GetInt64("runtime"),
-	}
-
-	return title, nil
+	return titleFromStmt(stmt), nil
 }
 
-func (r *Repository) PutTitle(title *model.Title) (titleId int64, err error) {
+// PutTitle inserts or updates a title. Its genres and credits are replaced too, unless they are nil.
+func (r *Repository) PutTitle(title *model.Title) (titleId model.TitleId, err error) {
 	defer sqlitex.Save(r.conn)(&err)
 	if title.Id == model.NoId {
 		titleId, err = r.insertTitle(title)
+	} else {
+		titleId = title.Id
+		err = r.updateTitle(title)
+	}
+	if err != nil {
 		return
 	}
-	titleId = title.Id
-	err = r.updateTitle(title)
+	if title.Genres != nil {
+		err = r.setTitleGenres(titleId, title.Genres)
+		if err != nil {
+			return
+		}
+	}
+	if title.Credits != nil {
+		err = r.setTitleCredits(titleId, title.Credits)
+	}
 	return
 }
 
-func (r *Repository) insertTitle(title *model.Title) (int64, error) {
+func (r *Repository) insertTitle(title *model.Title) (model.TitleId, error) {
 	stmt := r.conn.Prep(`
 INSERT INTO title (
 	id,
@@ -185,7 +278,10 @@ INSERT INTO title (
     name,
     year,
 	release_date,
-	runtime
+	runtime,
+	imdb_rating,
+	imdb_votes,
+	description
 )
 VALUES (
 	$id,
@@ -194,7 +290,10 @@ VALUES (
     $name,
     $year,
 	$releaseDate,
-	$runtime
+	$runtime,
+	$imdbRating,
+	$imdbVotes,
+	$description
 )
 ;`,
 	)
@@ -205,28 +304,248 @@ VALUES (
 	stmt.SetInt64("$year", title.Year)
 	stmt.SetText("$releaseDate", title.ReleaseDate)
 	stmt.SetInt64("$runtime", title.Runtime)
+	stmt.SetFloat("$imdbRating", title.ImdbRating)
+	stmt.SetInt64("$imdbVotes", title.ImdbVotes)
+	stmt.SetText("$description", title.Description)
 	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
 
 	if err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintUnique {
+			return model.NoId, ErrDuplicateTitle
+		}
 		return model.NoId, err
 	}
-	title.Id = id
+	title.Id = model.NewIdentifier(id)
 
-	return id, nil
+	return title.Id, nil
 }
 
 func (r *Repository) updateTitle(title *model.Title) error {
 	stmt := r.conn.Prep(`
 UPDATE title
-SET name = $name
+SET
+	imdb_id = $imdbId,
+	type = $type,
+	name = $name,
+	year = $year,
+	release_date = $releaseDate,
+	runtime = $runtime,
+	imdb_rating = $imdbRating,
+	imdb_votes = $imdbVotes,
+	description = $description
 WHERE id = $id
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$id", title.Id)
+	stmt.SetInt64("$id", title.Id.Int())
+	stmt.SetText("$imdbId", title.ImdbId)
+	stmt.SetText("$type", title.Type)
 	stmt.SetText("$name", title.Name)
+	stmt.SetInt64("$year", title.Year)
+	stmt.SetText("$releaseDate", title.ReleaseDate)
+	stmt.SetInt64("$runtime", title.Runtime)
+	stmt.SetFloat("$imdbRating", title.ImdbRating)
+	stmt.SetInt64("$imdbVotes", title.ImdbVotes)
+	stmt.SetText("$description", title.Description)
 	_, err := stmt.Step()
-	return err
+	if err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintUnique {
+			return ErrDuplicateTitle
+		}
+		return err
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchTitle
+	}
+	return nil
+}
+
+// DeleteTitle removes a title along with its genres, credits, service availability and every user's
+// watch history for it.
+func (r *Repository) DeleteTitle(titleId model.TitleId) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	if err = r.removeTitleFromLists(titleId); err != nil {
+		return err
+	}
+	if err = r.deleteTitleSeasons(titleId); err != nil {
+		return err
+	}
+	for _, table := range []string{"title_genre", "title_credit", "service_title", "watch_event", "watch_history", "user_rating"} {
+		stmt := r.conn.Prep("DELETE FROM " + table + " WHERE title_id = $titleId;")
+		stmt.SetInt64("$titleId", titleId.Int())
+		_, err = stmt.Step()
+		stmt.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to delete %s rows for title %s: %w", table, titleId, err)
+		}
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM title
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", titleId.Int())
+	_, err = stmt.Step()
+	if err != nil {
+		return fmt.Errorf("failed to delete title %s: %w", titleId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchTitle
+	}
+	return nil
+}
+
+// ImportTitle inserts the given title, or updates the existing title with the same IMDb ID.
+// Only the columns present in the IMDb datasets are overwritten on update, and the ratings
+// are left untouched unless hasRating is set. The genres are replaced unless they are nil.
+// The ID of the title is not filled in.
+func (r *Repository) ImportTitle(title *model.Title, hasRating bool) error {
+	stmt := r.conn.Prep(`
+INSERT INTO title (
+	id,
+	imdb_id,
+	type,
+	name,
+	year,
+	release_date,
+	runtime,
+	imdb_rating,
+	imdb_votes
+)
+VALUES (
+	$id,
+	$imdbId,
+	$type,
+	$name,
+	$year,
+	$releaseDate,
+	$runtime,
+	$imdbRating,
+	$imdbVotes
+)
+ON CONFLICT (imdb_id) DO UPDATE SET
+	type = excluded.type,
+	name = excluded.name,
+	year = excluded.year,
+	runtime = excluded.runtime,
+	imdb_rating = CASE WHEN $hasRating THEN excluded.imdb_rating ELSE imdb_rating END,
+	imdb_votes = CASE WHEN $hasRating THEN excluded.imdb_votes ELSE imdb_votes END
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$imdbId", title.ImdbId)
+	stmt.SetText("$type", title.Type)
+	stmt.SetText("$name", title.Name)
+	stmt.SetInt64("$year", title.Year)
+	stmt.SetText("$releaseDate", title.ReleaseDate)
+	stmt.SetInt64("$runtime", title.Runtime)
+	stmt.SetFloat("$imdbRating", title.ImdbRating)
+	stmt.SetInt64("$imdbVotes", title.ImdbVotes)
+	stmt.SetBool("$hasRating", hasRating)
+	_, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+	if err != nil {
+		return fmt.Errorf("failed to import title %s: %w", title.ImdbId, err)
+	}
+	if title.Genres == nil {
+		return nil
+	}
+
+	// The ID generated above isn't the title's if it already existed, so look it up.
+	idStmt := r.conn.Prep(`
+SELECT id
+FROM title
+WHERE imdb_id = $imdbId
+;`,
+	)
+	defer idStmt.Reset()
+	idStmt.SetText("$imdbId", title.ImdbId)
+	if _, err = idStmt.Step(); err != nil {
+		return fmt.Errorf("failed to retrieve imported title %s: %w", title.ImdbId, err)
+	}
+	return r.setTitleGenres(model.NewIdentifier(idStmt.GetInt64("id")), title.Genres)
+}
+
+// today is the current date, formatted as stored in the database.
+func today() string {
+	return time.Now().Format(time.DateOnly)
+}
+
+// setNullableText binds value to param, or NULL if value is empty.
+func setNullableText(stmt *sqlite.Stmt, param string, value string) {
+	if value == "" {
+		stmt.SetNull(param)
+	} else {
+		stmt.SetText(param, value)
+	}
+}
+
+// setNullableInt64 binds value to param, or NULL if value is zero.
+func setNullableInt64(stmt *sqlite.Stmt, param string, value int64) {
+	if value == 0 {
+		stmt.SetNull(param)
+	} else {
+		stmt.SetInt64(param, value)
+	}
+}
+
+// idArray encodes IDs as a JSON array of integers, to be expanded with json_each.
+func idArray(ids []model.Identifier) string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.FormatInt(id.Int(), 10)
+	}
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+// matchQuery converts a search typed by a user into an FTS5 query matching the prefix of every word in it,
+// so that the user doesn't need to know the FTS5 query syntax. It returns an empty string if there are no words.
+func matchQuery(search string) string {
+	words := strings.Fields(search)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// titleFromStmt reads a title from the current row of a statement that selects every title column, and
+// optionally episodeStatsColumns and ratingStatsColumns.
+func titleFromStmt(stmt *sqlite.Stmt) *model.Title {
+	title := &model.Title{
+		Id:          model.NewIdentifier(stmt.GetInt64("id")),
+		ImdbId:      stmt.GetText("imdb_id"),
+		Type:        stmt.GetText("type"),
+		Name:        stmt.GetText("name"),
+		Year:        stmt.GetInt64("year"),
+		ReleaseDate: stmt.GetText("release_date"),
+		Runtime:     stmt.GetInt64("runtime"),
+		ImdbRating:  stmt.GetFloat("imdb_rating"),
+		ImdbVotes:   stmt.GetInt64("imdb_votes"),
+		Description: stmt.GetText("description"),
+	}
+	if stmt.ColumnIndex("episode_count") >= 0 {
+		title.EpisodeCount = stmt.GetInt64("episode_count")
+		title.AverageEpisodeRuntime = stmt.GetInt64("average_episode_runtime")
+	}
+	if stmt.ColumnIndex("user_rating_count") >= 0 {
+		title.UserRating = stmt.GetFloat("user_rating")
+		title.UserRatingCount = stmt.GetInt64("user_rating_count")
+	}
+	return title
+}
+
+func watchHistoryFromStmt(stmt *sqlite.Stmt) *model.WatchHistory {
+	return &model.WatchHistory{
+		UserId:          model.NewIdentifier(stmt.GetInt64("user_id")),
+		TitleId:         model.NewIdentifier(stmt.GetInt64("title_id")),
+		Watched:         stmt.GetBool("watched"),
+		WatchCount:      stmt.GetInt64("watch_count"),
+		LastWatchedAt:   stmt.GetText("last_watched_at"),
+		EpisodesWatched: stmt.GetInt64("episodes_watched"),
+		WantToWatch:     stmt.GetInt64("want_to_watch"),
+		WantedSince:     stmt.GetText("wanted_since"),
+	}
 }
 
 func (r *Repository) GetServices() ([]*model.Service, error) {
@@ -245,7 +564,7 @@ FROM service
 			break
 		}
 		titles = append(titles, &model.Service{
-			Id:   stmt.GetInt64("id"),
+			Id:   model.NewIdentifier(stmt.GetInt64("id")),
 			Name: stmt.GetText("name"),
 		})
 	}
@@ -253,7 +572,7 @@ FROM service
 	return titles, nil
 }
 
-func (r *Repository) GetService(id int64) (*model.Service, error) {
+func (r *Repository) GetService(id model.ServiceId) (*model.Service, error) {
 	stmt := r.conn.Prep(`
 SELECT id, name
 FROM service
@@ -261,69 +580,265 @@ WHERE id = $id
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$id", id)
+	stmt.SetInt64("$id", id.Int())
 	if hasRow, err := stmt.Step(); err != nil {
-		return nil, fmt.Errorf("failed to retrieve service %d: %w", id, err)
+		return nil, fmt.Errorf("failed to retrieve service %s: %w", id, err)
 	} else if !hasRow {
 		return nil, ErrNoSuchService
 	}
 
 	service := &model.Service{
-		Id:   stmt.GetInt64("id"),
+		Id:   model.NewIdentifier(stmt.GetInt64("id")),
 		Name: stmt.GetText("name"),
 	}
 
 	return service, nil
 }
 
-func (r *Repository) GetUsers() ([]*model.User, error) {
+func (r *Repository) GetServicesByTitle(titleId model.TitleId) ([]*model.Service, error) {
 	stmt := r.conn.Prep(`
-SELECT id, username
+SELECT s.id, s.name
+FROM service s
+INNER JOIN service_title st on s.id = st.service_id
+WHERE st.title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+
+	services := make([]*model.Service, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve services: %w", err)
+		} else if !hasRow {
+			break
+		}
+		services = append(services, &model.Service{
+			Id:   model.NewIdentifier(stmt.GetInt64("id")),
+			Name: stmt.GetText("name"),
+		})
+	}
+
+	return services, nil
+}
+
+// GetTitleDeadlines retrieves the services a title is due to leave, soonest first. Whether something
+// finishes in time is left for the caller to fill in.
+func (r *Repository) GetTitleDeadlines(titleId model.TitleId) ([]*model.BingeDeadline, error) {
+	stmt := r.conn.Prep(`
+SELECT s.id, s.name, st.available_until
+FROM service s
+INNER JOIN service_title st ON s.id = st.service_id
+WHERE st.title_id = $titleId AND st.available_until >= $today
+ORDER BY st.available_until, s.name
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$titleId", titleId.Int())
+	stmt.SetText("$today", today())
+
+	deadlines := make([]*model.BingeDeadline, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve deadlines for title %s: %w", titleId, err)
+		} else if !hasRow {
+			break
+		}
+		deadlines = append(deadlines, &model.BingeDeadline{
+			ServiceId:      model.NewIdentifier(stmt.GetInt64("id")),
+			ServiceName:    stmt.GetText("name"),
+			AvailableUntil: stmt.GetText("available_until"),
+		})
+	}
+
+	return deadlines, nil
+}
+
+// PutServiceTitle records that a title is available on a service, replacing any existing availability window.
+func (r *Repository) PutServiceTitle(serviceTitle *model.ServiceTitle) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+	if _, err = r.GetService(serviceTitle.ServiceId); err != nil {
+		return
+	}
+	if _, err = r.GetTitle(serviceTitle.TitleId); err != nil {
+		return
+	}
+
+	stmt := r.conn.Prep(`
+INSERT INTO service_title (
+	service_id,
+	title_id,
+	available_from,
+	available_until
+)
+VALUES (
+	$serviceId,
+	$titleId,
+	$availableFrom,
+	$availableUntil
+)
+ON CONFLICT DO UPDATE SET
+	available_from = excluded.available_from,
+	available_until = excluded.available_until
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$serviceId", serviceTitle.ServiceId.Int())
+	stmt.SetInt64("$titleId", serviceTitle.TitleId.Int())
+	setNullableText(stmt, "$availableFrom", serviceTitle.AvailableFrom)
+	setNullableText(stmt, "$availableUntil", serviceTitle.AvailableUntil)
+	_, err = stmt.Step()
+	return
+}
+
+// A ServiceTitleFilter narrows the titles on a service to those arriving or leaving soon.
+// The zero value matches every title that is currently available.
+type ServiceTitleFilter struct {
+	// LeavingWithinDays matches titles whose availability ends within this many days.
+	LeavingWithinDays int
+	// AddedWithinDays matches titles whose availability began within this many days.
+	AddedWithinDays int
+}
+
+// GetServiceTitles retrieves the titles currently available on a service along with their availability windows.
+// Titles leaving soon are ordered by when they leave; otherwise the newest arrivals come first.
+func (r *Repository) GetServiceTitles(serviceId model.ServiceId, filter ServiceTitleFilter) ([]*model.ServiceTitle, error) {
+	stmt := r.conn.Prep(`
+SELECT
+	st.service_id, st.title_id, st.available_from, st.available_until,
+	t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description
+FROM service_title st
+INNER JOIN title t on t.id = st.title_id
+WHERE st.service_id = $serviceId
+	AND (st.available_from IS NULL OR st.available_from <= $today)
+	AND (st.available_until IS NULL OR st.available_until >= $today)
+	AND ($leavingBy IS NULL OR st.available_until <= $leavingBy)
+	AND ($addedSince IS NULL OR st.available_from >= $addedSince)
+ORDER BY
+	CASE WHEN $leavingBy IS NULL THEN NULL ELSE st.available_until END,
+	st.available_from DESC,
+	t.name
+;`,
+	)
+	defer stmt.Reset()
+	now := time.Now()
+	stmt.SetInt64("$serviceId", serviceId.Int())
+	stmt.SetText("$today", now.Format(time.DateOnly))
+	if filter.LeavingWithinDays > 0 {
+		stmt.SetText("$leavingBy", now.AddDate(0, 0, filter.LeavingWithinDays).Format(time.DateOnly))
+	} else {
+		stmt.SetNull("$leavingBy")
+	}
+	if filter.AddedWithinDays > 0 {
+		stmt.SetText("$addedSince", now.AddDate(0, 0, -filter.AddedWithinDays).Format(time.DateOnly))
+	} else {
+		stmt.SetNull("$addedSince")
+	}
+
+	serviceTitles := make([]*model.ServiceTitle, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve titles for service %s: %w", serviceId, err)
+		} else if !hasRow {
+			break
+		}
+		serviceTitles = append(serviceTitles, &model.ServiceTitle{
+			ServiceId:      model.NewIdentifier(stmt.GetInt64("service_id")),
+			TitleId:        model.NewIdentifier(stmt.GetInt64("title_id")),
+			AvailableFrom:  stmt.GetText("available_from"),
+			AvailableUntil: stmt.GetText("available_until"),
+			Title:          titleFromStmt(stmt),
+		})
+	}
+
+	return serviceTitles, nil
+}
+
+func (r *Repository) DeleteServiceTitle(serviceId model.ServiceId, titleId model.TitleId) error {
+	stmt := r.conn.Prep(`
+DELETE FROM service_title
+WHERE service_id = $serviceId AND title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$serviceId", serviceId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to remove title %s from service %s: %w", titleId, serviceId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchServiceTitle
+	}
+	return nil
+}
+
+// GetUsers retrieves a page of users in order of username.
+func (r *Repository) GetUsers(page Page) ([]*model.User, *Cursor, error) {
+	if err := page.checkCursor("username"); err != nil {
+		return nil, nil, err
+	}
+	stmt := r.conn.Prep(`
+SELECT id, username, role, pick_strategy, username AS sort_value, id AS cursor_id
 FROM user
+WHERE $cursorId IS NULL OR (username, id) > ($cursorValue, $cursorId)
+ORDER BY username, id
+LIMIT $limit
 ;`,
 	)
 	defer stmt.Reset()
+	page.bindCursor(stmt)
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
 
-	titles := make([]*model.User, 0)
+	users := make([]*model.User, 0)
+	var last, next *Cursor
 	for {
 		if hasRow, err := stmt.Step(); err != nil {
-			return nil, fmt.Errorf("failed to retrieve users: %w", err)
+			return nil, nil, fmt.Errorf("failed to retrieve users: %w", err)
 		} else if !hasRow {
 			break
 		}
-		titles = append(titles, &model.User{
-			Id:       stmt.GetInt64("id"),
-			Username: stmt.GetText("username"),
+		if len(users) == page.Limit {
+			next = last
+			break
+		}
+		users = append(users, &model.User{
+			Id:           model.NewIdentifier(stmt.GetInt64("id")),
+			Username:     stmt.GetText("username"),
+			Role:         stmt.GetText("role"),
+			PickStrategy: stmt.GetText("pick_strategy"),
 		})
+		last = cursorFromStmt(stmt, "username")
 	}
 
-	return titles, nil
+	return users, next, nil
 }
 
-func (r *Repository) GetUser(id int64) (*model.User, error) {
+func (r *Repository) GetUser(id model.UserId) (*model.User, error) {
 	stmt := r.conn.Prep(`
-SELECT id, username
+SELECT id, username, role, pick_strategy
 FROM user
 WHERE id = $id
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$id", id)
+	stmt.SetInt64("$id", id.Int())
 	if hasRow, err := stmt.Step(); err != nil {
-		return nil, fmt.Errorf("failed to retrieve user %d: %w", id, err)
+		return nil, fmt.Errorf("failed to retrieve user %s: %w", id, err)
 	} else if !hasRow {
 		return nil, ErrNoSuchUser
 	}
 
 	user := &model.User{
-		Id:       stmt.GetInt64("id"),
-		Username: stmt.GetText("username"),
+		Id:           model.NewIdentifier(stmt.GetInt64("id")),
+		Username:     stmt.GetText("username"),
+		Role:         stmt.GetText("role"),
+		PickStrategy: stmt.GetText("pick_strategy"),
 	}
 
 	return user, nil
 }
 
-func (r *Repository) PutUser(user *model.User) (userId int64, err error) {
+func (r *Repository) PutUser(user *model.User) (userId model.UserId, err error) {
 	defer sqlitex.Save(r.conn)(&err)
 	if user.Id == model.NoId {
 		userId, err = r.insertUser(user)
@@ -334,100 +849,287 @@ func (r *Repository) PutUser(user *model.User) (userId int64, err error) {
 	return
 }
 
-func (r *Repository) insertUser(user *model.User) (int64, error) {
+func (r *Repository) insertUser(user *model.User) (model.UserId, error) {
 	stmt := r.conn.Prep(`
 INSERT INTO user (
 	id,
-    username
+    username,
+	role,
+	pick_strategy
 )
 VALUES (
 	$id,
-    $username
+    $username,
+	$role,
+	$pickStrategy
 )
 ;`,
 	)
 	defer stmt.Reset()
+	if user.Role == "" {
+		user.Role = model.RoleMember
+	}
 	stmt.SetText("$username", user.Username)
+	stmt.SetText("$role", user.Role)
+	setNullableText(stmt, "$pickStrategy", user.PickStrategy)
 	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
 
 	if err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintUnique {
+			return model.NoId, ErrDuplicateUser
+		}
 		return model.NoId, err
 	}
-	user.Id = id
+	user.Id = model.NewIdentifier(id)
 
-	return id, nil
+	return user.Id, nil
 }
 
 func (r *Repository) updateUser(user *model.User) error {
 	stmt := r.conn.Prep(`
 UPDATE user
-SET username = $username
+SET
+	username = $username,
+	role = $role,
+	pick_strategy = $pickStrategy
 WHERE id = $id
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$id", user.Id)
+	stmt.SetInt64("$id", user.Id.Int())
 	stmt.SetText("$username", user.Username)
+	stmt.SetText("$role", user.Role)
+	setNullableText(stmt, "$pickStrategy", user.PickStrategy)
 	_, err := stmt.Step()
-	return err
+	if err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintUnique {
+			return ErrDuplicateUser
+		}
+		return err
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchUser
+	}
+	return nil
 }
 
-func (r *Repository) GetUserWatchHistory(userId int64) ([]*model.WatchHistory, error) {
+func (r *Repository) CountUsersWithRole(role string) (int64, error) {
 	stmt := r.conn.Prep(`
-SELECT user_id, title_id, watched, want_to_watch
-FROM watch_history
-WHERE user_id = $userId
+SELECT count(*) AS n
+FROM user
+WHERE role = $role
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$role", role)
+	if _, err := stmt.Step(); err != nil {
+		return 0, fmt.Errorf("failed to count users with role %s: %w", role, err)
+	}
+	return stmt.GetInt64("n"), nil
+}
+
+// GetUserWatchHistory retrieves a page of the user's watch history in order of title ID.
+func (r *Repository) GetUserWatchHistory(userId model.UserId, page Page) ([]*model.WatchHistory, *Cursor, error) {
+	if err := page.checkCursor("title_id"); err != nil {
+		return nil, nil, err
+	}
+	stmt := r.conn.Prep(`
+SELECT
+	wh.user_id, wh.title_id, wh.watched, wh.want_to_watch, wh.wanted_since,
+	count(we.id) AS watch_count,
+	max(we.watched_at) AS last_watched_at,
+	(
+		SELECT count(DISTINCT episode_id)
+		FROM watch_event
+		WHERE user_id = wh.user_id AND title_id = wh.title_id AND episode_id IS NOT NULL
+	) AS episodes_watched,
+	wh.title_id AS cursor_id
+FROM watch_history wh
+LEFT JOIN watch_event we ON we.user_id = wh.user_id AND we.title_id = wh.title_id AND we.episode_id IS NULL
+WHERE wh.user_id = $userId
+	AND ($cursorId IS NULL OR wh.title_id > $cursorId)
+GROUP BY wh.title_id
+ORDER BY wh.title_id
+LIMIT $limit
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$userId", userId)
+	stmt.SetInt64("$userId", userId.Int())
+	page.bindCursor(stmt)
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
 
 	watchHistory := make([]*model.WatchHistory, 0)
+	var last, next *Cursor
 	for {
 		if hasRow, err := stmt.Step(); err != nil {
-			return nil, fmt.Errorf("failed to retrieve watch history: %w", err)
+			return nil, nil, fmt.Errorf("failed to retrieve watch history: %w", err)
 		} else if !hasRow {
 			break
 		}
-		watchHistory = append(watchHistory, &model.WatchHistory{
-			UserId:      stmt.GetInt64("user_id"),
-			TitleId:     stmt.GetInt64("title_id"),
-			Watched:     stmt.GetBool("watched"),
-			WantToWatch: stmt.GetInt64("want_to_watch"),
-		})
+		if len(watchHistory) == page.Limit {
+			next = last
+			break
+		}
+		watchHistory = append(watchHistory, watchHistoryFromStmt(stmt))
+		last = cursorFromStmt(stmt, "title_id")
+	}
+
+	return watchHistory, next, nil
+}
+
+// GetWatchHistory retrieves what the user thinks of a title. Titles the user has never recorded anything
+// about have an empty watch history.
+func (r *Repository) GetWatchHistory(userId model.UserId, titleId model.TitleId) (*model.WatchHistory, error) {
+	stmt := r.conn.Prep(`
+SELECT
+	$userId AS user_id, $titleId AS title_id,
+	coalesce(wh.watched, 0) AS watched,
+	coalesce(wh.want_to_watch, 0) AS want_to_watch,
+	wh.wanted_since,
+	(
+		SELECT count(*)
+		FROM watch_event
+		WHERE user_id = $userId AND title_id = $titleId AND episode_id IS NULL
+	) AS watch_count,
+	(
+		SELECT max(watched_at)
+		FROM watch_event
+		WHERE user_id = $userId AND title_id = $titleId AND episode_id IS NULL
+	) AS last_watched_at,
+	(
+		SELECT count(DISTINCT episode_id)
+		FROM watch_event
+		WHERE user_id = $userId AND title_id = $titleId AND episode_id IS NOT NULL
+	) AS episodes_watched
+FROM (SELECT 1)
+LEFT JOIN watch_history wh ON wh.user_id = $userId AND wh.title_id = $titleId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve watch history for title %s: %w", titleId, err)
 	}
 
-	return watchHistory, nil
+	return watchHistoryFromStmt(stmt), nil
 }
 
-func (r *Repository) PutWatchHistory(watchHistory *model.WatchHistory) error {
+// PutWatchHistory records what the user thinks of a title. Marking a title as watched records a watch event
+// for it now unless the user has already watched it, and marking it as unwatched deletes the user's watch
+// events for the whole title. The rest of the watch history is filled in from the result.
+func (r *Repository) PutWatchHistory(watchHistory *model.WatchHistory) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
 	stmt := r.conn.Prep(`
 INSERT INTO watch_history (
 	user_id,
-    title_id,
+	title_id,
 	watched,
-	want_to_watch
+	want_to_watch,
+	wanted_since
 )
 VALUES (
 	$userId,
-    $titleId,
-	$watched,
-	$wantToWatch
+	$titleId,
+	0,
+	$wantToWatch,
+	CASE WHEN $wantToWatch > 0 THEN $now END
 )
 ON CONFLICT DO UPDATE SET
-	watched = excluded.watched,
-	want_to_watch = excluded.want_to_watch
+	want_to_watch = excluded.want_to_watch,
+	wanted_since = CASE
+		WHEN excluded.want_to_watch > 0 THEN coalesce(wanted_since, excluded.wanted_since)
+	END
+RETURNING watched
 ;`,
 	)
 	defer stmt.Reset()
-	stmt.SetInt64("$userId", watchHistory.UserId)
-	stmt.SetInt64("$titleId", watchHistory.TitleId)
-	stmt.SetBool("$watched", watchHistory.Watched)
+	now := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$userId", watchHistory.UserId.Int())
+	stmt.SetInt64("$titleId", watchHistory.TitleId.Int())
 	stmt.SetInt64("$wantToWatch", watchHistory.WantToWatch)
+	stmt.SetText("$now", now)
 
-	_, err := stmt.Step()
+	if _, err = stmt.Step(); err != nil {
+		return err
+	}
+	watched := stmt.GetBool("watched")
+	stmt.Reset()
+
+	if watchHistory.Watched && !watched {
+		_, err = r.CreateWatchEvent(&model.WatchEvent{
+			UserId:    watchHistory.UserId,
+			TitleId:   watchHistory.TitleId,
+			WatchedAt: now,
+			Source:    model.WatchSourceWatchHistory,
+		})
+	} else if !watchHistory.Watched && watched {
+		err = r.deleteTitleWatchEvents(watchHistory.UserId, watchHistory.TitleId)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := r.GetWatchHistory(watchHistory.UserId, watchHistory.TitleId)
+	if err != nil {
+		return err
+	}
+	*watchHistory = *current
+
+	return nil
+}
+
+// GetWatchedTitles retrieves the titles the user has watched, in order of name.
+func (r *Repository) GetWatchedTitles(userId model.UserId) ([]*model.Title, error) {
+	stmt := r.conn.Prep(`
+SELECT t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description
+FROM title t
+INNER JOIN watch_history wh ON wh.title_id = t.id
+WHERE wh.user_id = $userId AND wh.watched
+ORDER BY t.name, t.id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+
+	titles := make([]*model.Title, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve watched titles: %w", err)
+		} else if !hasRow {
+			break
+		}
+		titles = append(titles, titleFromStmt(stmt))
+	}
+
+	return titles, nil
+}
+
+// GetWantedTitles retrieves the titles the user wants to watch, the most wanted first,
+// with ties going to the title wanted for longest.
+func (r *Repository) GetWantedTitles(userId model.UserId) ([]*model.Title, error) {
+	stmt := r.conn.Prep(`
+SELECT t.id, t.imdb_id, t.type, t.name, t.year, t.release_date, t.runtime, t.imdb_rating, t.imdb_votes, t.description
+FROM title t
+INNER JOIN watch_history wh ON wh.title_id = t.id
+WHERE wh.user_id = $userId AND wh.want_to_watch > 0
+ORDER BY wh.want_to_watch DESC, wh.wanted_since, t.id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+
+	titles := make([]*model.Title, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve wanted titles: %w", err)
+		} else if !hasRow {
+			break
+		}
+		titles = append(titles, titleFromStmt(stmt))
+	}
 
-	return err
+	return titles, nil
 }
 
 // applyMigrations walks through the scripts in the migration directory,
@@ -440,6 +1142,10 @@ func (r *Repository) applyMigrations() (err error) {
 		return
 	}
 	log.Println("current schema version is", version)
+	err = createMigrationFunctions(r.conn)
+	if err != nil {
+		return
+	}
 	err = fs.WalkDir(
 		migrations,
 		"migrations",
@@ -467,6 +1173,33 @@ func (r *Repository) applyMigrations() (err error) {
 	return
 }
 
+// createMigrationFunctions provides SQL functions for migrations that convert data in ways plain SQL can't.
+func createMigrationFunctions(conn *sqlite.Conn) error {
+	functions := map[string]func(sqlite.Value) sqlite.Value{
+		// hash_token hashes a token that used to be stored as it is.
+		"hash_token": func(token sqlite.Value) sqlite.Value {
+			return sqlite.TextValue(auth.HashToken(token.Text()))
+		},
+		// format_id encodes an ID stored as a number in JSON the way it is encoded now.
+		"format_id": func(id sqlite.Value) sqlite.Value {
+			return sqlite.TextValue(model.NewIdentifier(id.Int64()).String())
+		},
+	}
+	for name, fn := range functions {
+		err := conn.CreateFunction(name, &sqlite.FunctionImpl{
+			NArgs:         1,
+			Deterministic: true,
+			Scalar: func(ctx sqlite.Context, args []sqlite.Value) (sqlite.Value, error) {
+				return fn(args[0]), nil
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create migration function %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
 // getSchemaVersion gets the ID of the most recent migration to have run on the database.
 func getSchemaVersion(conn *sqlite.Conn) (version int64, err error) {
 	stmt, _, err := conn.PrepareTransient("PRAGMA user_version;")
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"time"
+)
+
+var ErrNoSuchSession = errors.New("session does not exist or has expired")
+
+func (r *Repository) GetUserByUsername(username string) (*model.User, error) {
+	stmt := r.conn.Prep(`
+SELECT id, username, role, pick_strategy
+FROM user
+WHERE username = $username
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$username", username)
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve user `%s`: %w", username, err)
+	} else if !hasRow {
+		return nil, ErrNoSuchUser
+	}
+
+	user := &model.User{
+		Id:           model.NewIdentifier(stmt.GetInt64("id")),
+		Username:     stmt.GetText("username"),
+		Role:         stmt.GetText("role"),
+		PickStrategy: stmt.GetText("pick_strategy"),
+	}
+
+	return user, nil
+}
+
+// GetUserPasswordHash retrieves the user's password hash, which is empty if they have no password.
+func (r *Repository) GetUserPasswordHash(userId model.UserId) (string, error) {
+	stmt := r.conn.Prep(`
+SELECT password_hash
+FROM user
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", userId.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return "", fmt.Errorf("failed to retrieve password for user %s: %w", userId, err)
+	} else if !hasRow {
+		return "", ErrNoSuchUser
+	}
+
+	return stmt.GetText("password_hash"), nil
+}
+
+// SetUserPassword replaces the user's password hash and ends all of their sessions.
+func (r *Repository) SetUserPassword(userId model.UserId, passwordHash string) (err error) {
+	defer r.Transact()(&err)
+	stmt := r.conn.Prep(`
+UPDATE user
+SET password_hash = $passwordHash
+WHERE id = $id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", userId.Int())
+	stmt.SetText("$passwordHash", passwordHash)
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to set password for user %s: %w", userId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchUser
+	}
+
+	deleteStmt := r.conn.Prep(`
+DELETE FROM session
+WHERE user_id = $userId
+;`,
+	)
+	defer deleteStmt.Reset()
+	deleteStmt.SetInt64("$userId", userId.Int())
+	if _, err = deleteStmt.Step(); err != nil {
+		return fmt.Errorf("failed to end sessions for user %s: %w", userId, err)
+	}
+	return nil
+}
+
+// CreateSession starts a session for the user, identified by the hash of its token.
+// Expired sessions are cleaned up at the same time.
+func (r *Repository) CreateSession(userId model.UserId, tokenHash string, expiresAt time.Time) (err error) {
+	defer r.Transact()(&err)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	deleteStmt := r.conn.Prep(`
+DELETE FROM session
+WHERE expires_at <= $now
+;`,
+	)
+	defer deleteStmt.Reset()
+	deleteStmt.SetText("$now", now)
+	if _, err = deleteStmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	stmt := r.conn.Prep(`
+INSERT INTO session (
+	token_hash,
+	user_id,
+	created_at,
+	expires_at
+)
+VALUES (
+	$tokenHash,
+	$userId,
+	$createdAt,
+	$expiresAt
+)
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$tokenHash", tokenHash)
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetText("$createdAt", now)
+	stmt.SetText("$expiresAt", expiresAt.UTC().Format(time.RFC3339))
+	if _, err = stmt.Step(); err != nil {
+		return fmt.Errorf("failed to create session for user %s: %w", userId, err)
+	}
+	return nil
+}
+
+// GetSessionUser retrieves the user whose unexpired session is identified by the hash of its token.
+func (r *Repository) GetSessionUser(tokenHash string) (*model.User, error) {
+	stmt := r.conn.Prep(`
+SELECT u.id, u.username, u.role, u.pick_strategy
+FROM session s
+INNER JOIN user u ON u.id = s.user_id
+WHERE s.token_hash = $tokenHash AND s.expires_at > $now
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$tokenHash", tokenHash)
+	stmt.SetText("$now", time.Now().UTC().Format(time.RFC3339))
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve session: %w", err)
+	} else if !hasRow {
+		return nil, ErrNoSuchSession
+	}
+
+	user := &model.User{
+		Id:           model.NewIdentifier(stmt.GetInt64("id")),
+		Username:     stmt.GetText("username"),
+		Role:         stmt.GetText("role"),
+		PickStrategy: stmt.GetText("pick_strategy"),
+	}
+
+	return user, nil
+}
+
+func (r *Repository) DeleteSession(tokenHash string) error {
+	stmt := r.conn.Prep(`
+DELETE FROM session
+WHERE token_hash = $tokenHash
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$tokenHash", tokenHash)
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
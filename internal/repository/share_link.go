@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"time"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var ErrNoSuchShareLink = errors.New("share link does not exist")
+
+// GetUserShareLinks retrieves the share links the user made, along with those members made to lists the
+// user owns, so that the user can revoke them.
+func (r *Repository) GetUserShareLinks(userId model.UserId) ([]*model.ShareLink, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, kind, list_id, created_at
+FROM share_link
+WHERE user_id = $userId
+	OR list_id IN (SELECT id FROM list WHERE user_id = $userId)
+ORDER BY created_at, id
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+
+	links := make([]*model.ShareLink, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve share links: %w", err)
+		} else if !hasRow {
+			break
+		}
+		links = append(links, shareLinkFromStmt(stmt))
+	}
+
+	return links, nil
+}
+
+// GetShareLinkByToken looks up the share link whose token has the given hash.
+func (r *Repository) GetShareLinkByToken(tokenHash string) (*model.ShareLink, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, kind, list_id, created_at
+FROM share_link
+WHERE token_hash = $tokenHash
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetText("$tokenHash", tokenHash)
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve share link: %w", err)
+	} else if !hasRow {
+		return nil, ErrNoSuchShareLink
+	}
+
+	return shareLinkFromStmt(stmt), nil
+}
+
+// CreateShareLink stores a share link along with the hash of its token.
+func (r *Repository) CreateShareLink(link *model.ShareLink, tokenHash string) (model.Identifier, error) {
+	stmt := r.conn.Prep(`
+INSERT INTO share_link (
+	id,
+	token_hash,
+	user_id,
+	kind,
+	list_id,
+	created_at
+)
+VALUES (
+	$id,
+	$tokenHash,
+	$userId,
+	$kind,
+	$listId,
+	$createdAt
+)
+;`,
+	)
+	defer stmt.Reset()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetText("$tokenHash", tokenHash)
+	stmt.SetInt64("$userId", link.UserId.Int())
+	stmt.SetText("$kind", link.Kind)
+	setNullableInt64(stmt, "$listId", link.ListId.Int())
+	stmt.SetText("$createdAt", createdAt)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		return model.NoId, fmt.Errorf("failed to create share link: %w", err)
+	}
+	link.Id = model.NewIdentifier(id)
+	link.CreatedAt = createdAt
+
+	return link.Id, nil
+}
+
+// DeleteShareLink revokes one of the user's share links, or a link to a list the user owns.
+func (r *Repository) DeleteShareLink(userId model.UserId, linkId model.Identifier) error {
+	stmt := r.conn.Prep(`
+DELETE FROM share_link
+WHERE id = $id
+	AND (user_id = $userId OR list_id IN (SELECT id FROM list WHERE user_id = $userId))
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", linkId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete share link %s: %w", linkId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchShareLink
+	}
+	return nil
+}
+
+func shareLinkFromStmt(stmt *sqlite.Stmt) *model.ShareLink {
+	return &model.ShareLink{
+		Id:        model.NewIdentifier(stmt.GetInt64("id")),
+		UserId:    model.NewIdentifier(stmt.GetInt64("user_id")),
+		Kind:      stmt.GetText("kind"),
+		ListId:    model.NewIdentifier(stmt.GetInt64("list_id")),
+		CreatedAt: stmt.GetText("created_at"),
+	}
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"time"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var (
+	ErrNoSuchSmartList    = errors.New("smart list does not exist")
+	ErrDuplicateSmartList = errors.New("smart list with that name already exists")
+)
+
+func (r *Repository) GetUserSmartLists(userId model.UserId) ([]*model.SmartList, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, name, filter, created_at
+FROM smart_list
+WHERE user_id = $userId
+ORDER BY name
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+
+	smartLists := make([]*model.SmartList, 0)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve smart lists: %w", err)
+		} else if !hasRow {
+			break
+		}
+		smartLists = append(smartLists, smartListFromStmt(stmt))
+	}
+
+	return smartLists, nil
+}
+
+// GetSmartList retrieves one of the user's smart lists.
+func (r *Repository) GetSmartList(userId model.UserId, smartListId model.Identifier) (*model.SmartList, error) {
+	stmt := r.conn.Prep(`
+SELECT id, user_id, name, filter, created_at
+FROM smart_list
+WHERE id = $id AND user_id = $userId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", smartListId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if hasRow, err := stmt.Step(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve smart list %s: %w", smartListId, err)
+	} else if !hasRow {
+		return nil, ErrNoSuchSmartList
+	}
+
+	return smartListFromStmt(stmt), nil
+}
+
+// GetSmartListUsers retrieves the IDs of the users a smart list's filter names, by the username they had when
+// the list was saved.
+func (r *Repository) GetSmartListUsers(smartListId model.Identifier) (map[string]model.UserId, error) {
+	stmt := r.conn.Prep(`
+SELECT username, user_id
+FROM smart_list_user
+WHERE smart_list_id = $smartListId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$smartListId", smartListId.Int())
+
+	userIds := make(map[string]model.UserId)
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve users for smart list %s: %w", smartListId, err)
+		} else if !hasRow {
+			break
+		}
+		userIds[stmt.GetText("username")] = model.NewIdentifier(stmt.GetInt64("user_id"))
+	}
+
+	return userIds, nil
+}
+
+// CreateSmartList saves a new smart list along with the users its filter names.
+func (r *Repository) CreateSmartList(smartList *model.SmartList) (id model.Identifier, err error) {
+	defer sqlitex.Save(r.conn)(&err)
+
+	stmt := r.conn.Prep(`
+INSERT INTO smart_list (
+	id,
+	user_id,
+	name,
+	filter,
+	created_at
+)
+VALUES (
+	$id,
+	$userId,
+	$name,
+	$filter,
+	$createdAt
+)
+;`,
+	)
+	defer stmt.Reset()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	stmt.SetInt64("$userId", smartList.UserId.Int())
+	stmt.SetText("$name", smartList.Name)
+	stmt.SetText("$filter", smartList.Filter)
+	stmt.SetText("$createdAt", createdAt)
+	rowId, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		if sqlite.ErrCode(err) == sqlite.ResultConstraintUnique {
+			return model.NoId, ErrDuplicateSmartList
+		}
+		return model.NoId, fmt.Errorf("failed to create smart list: %w", err)
+	}
+	smartList.Id = model.NewIdentifier(rowId)
+	smartList.CreatedAt = createdAt
+
+	userStmt := r.conn.Prep(`
+INSERT INTO smart_list_user (smart_list_id, username, user_id)
+VALUES ($smartListId, $username, $userId)
+;`,
+	)
+	for username, userId := range smartList.UserIds {
+		userStmt.SetInt64("$smartListId", smartList.Id.Int())
+		userStmt.SetText("$username", username)
+		userStmt.SetInt64("$userId", userId.Int())
+		_, err = userStmt.Step()
+		userStmt.Reset()
+		if err != nil {
+			return model.NoId, fmt.Errorf("failed to save users for smart list %s: %w", smartList.Id, err)
+		}
+	}
+
+	return smartList.Id, nil
+}
+
+// DeleteSmartList deletes one of the user's smart lists.
+func (r *Repository) DeleteSmartList(userId model.UserId, smartListId model.Identifier) (err error) {
+	defer sqlitex.Save(r.conn)(&err)
+
+	userStmt := r.conn.Prep(`
+DELETE FROM smart_list_user
+WHERE smart_list_id = (
+	SELECT id
+	FROM smart_list
+	WHERE id = $id AND user_id = $userId
+)
+;`,
+	)
+	defer userStmt.Reset()
+	userStmt.SetInt64("$id", smartListId.Int())
+	userStmt.SetInt64("$userId", userId.Int())
+	if _, err := userStmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete users for smart list %s: %w", smartListId, err)
+	}
+
+	stmt := r.conn.Prep(`
+DELETE FROM smart_list
+WHERE id = $id AND user_id = $userId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", smartListId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete smart list %s: %w", smartListId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchSmartList
+	}
+	return nil
+}
+
+func smartListFromStmt(stmt *sqlite.Stmt) *model.SmartList {
+	return &model.SmartList{
+		Id:        model.NewIdentifier(stmt.GetInt64("id")),
+		UserId:    model.NewIdentifier(stmt.GetInt64("user_id")),
+		Name:      stmt.GetText("name"),
+		Filter:    stmt.GetText("filter"),
+		CreatedAt: stmt.GetText("created_at"),
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/model"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var ErrNoSuchWatchEvent = errors.New("watch event does not exist")
+
+// GetUserWatchEvents retrieves a page of the user's watch events, the most recent first. If since is not
+// empty, only events from that time on are included.
+func (r *Repository) GetUserWatchEvents(userId model.UserId, since string, page Page) ([]*model.WatchEvent, *Cursor, error) {
+	if err := page.checkCursor("-watched_at"); err != nil {
+		return nil, nil, err
+	}
+	stmt := r.conn.Prep(`
+SELECT id, user_id, title_id, watched_at, episode_id, rating, source, watched_at AS sort_value, id AS cursor_id
+FROM watch_event
+WHERE user_id = $userId
+	AND ($since IS NULL OR watched_at >= $since)
+	AND ($cursorId IS NULL OR (watched_at, id) < ($cursorValue, $cursorId))
+ORDER BY watched_at DESC, id DESC
+LIMIT $limit
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	setNullableText(stmt, "$since", since)
+	page.bindCursor(stmt)
+	stmt.SetInt64("$limit", int64(page.Limit)+1)
+
+	events := make([]*model.WatchEvent, 0)
+	var last, next *Cursor
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve watch events: %w", err)
+		} else if !hasRow {
+			break
+		}
+		if len(events) == page.Limit {
+			next = last
+			break
+		}
+		events = append(events, watchEventFromStmt(stmt))
+		last = cursorFromStmt(stmt, "-watched_at")
+	}
+
+	return events, next, nil
+}
+
+// CreateWatchEvent records that the user watched a title. WatchedAt must be in UTC, so that events sort
+// in the order they happened.
+func (r *Repository) CreateWatchEvent(event *model.WatchEvent) (model.Identifier, error) {
+	if _, err := r.GetTitle(event.TitleId); err != nil {
+		return model.NoId, err
+	}
+	if event.EpisodeId != model.NoId {
+		if episode, err := r.GetEpisode(event.EpisodeId); err != nil {
+			return model.NoId, err
+		} else if episode.TitleId != event.TitleId {
+			return model.NoId, ErrNoSuchEpisode
+		}
+	}
+	stmt := r.conn.Prep(`
+INSERT INTO watch_event (
+	id,
+	user_id,
+	title_id,
+	watched_at,
+	episode_id,
+	rating,
+	source
+)
+VALUES (
+	$id,
+	$userId,
+	$titleId,
+	$watchedAt,
+	$episodeId,
+	$rating,
+	$source
+)
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", event.UserId.Int())
+	stmt.SetInt64("$titleId", event.TitleId.Int())
+	stmt.SetText("$watchedAt", event.WatchedAt)
+	setNullableInt64(stmt, "$episodeId", event.EpisodeId.Int())
+	if event.Rating == 0 {
+		stmt.SetNull("$rating")
+	} else {
+		stmt.SetFloat("$rating", event.Rating)
+	}
+	stmt.SetText("$source", event.Source)
+	id, err := sqlitex.InsertRandID(stmt, "$id", minId, maxId)
+
+	if err != nil {
+		return model.NoId, fmt.Errorf("failed to create watch event: %w", err)
+	}
+	event.Id = model.NewIdentifier(id)
+
+	return event.Id, nil
+}
+
+// DeleteWatchEvent deletes one of the user's watch events.
+func (r *Repository) DeleteWatchEvent(userId model.UserId, eventId model.Identifier) error {
+	stmt := r.conn.Prep(`
+DELETE FROM watch_event
+WHERE id = $id AND user_id = $userId
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$id", eventId.Int())
+	stmt.SetInt64("$userId", userId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete watch event %s: %w", eventId, err)
+	}
+	if r.conn.Changes() == 0 {
+		return ErrNoSuchWatchEvent
+	}
+	return nil
+}
+
+// deleteTitleWatchEvents deletes the user's watch events for a whole title, leaving those for its episodes.
+func (r *Repository) deleteTitleWatchEvents(userId model.UserId, titleId model.TitleId) error {
+	stmt := r.conn.Prep(`
+DELETE FROM watch_event
+WHERE user_id = $userId AND title_id = $titleId AND episode_id IS NULL
+;`,
+	)
+	defer stmt.Reset()
+	stmt.SetInt64("$userId", userId.Int())
+	stmt.SetInt64("$titleId", titleId.Int())
+	if _, err := stmt.Step(); err != nil {
+		return fmt.Errorf("failed to delete watch events for title %s: %w", titleId, err)
+	}
+	return nil
+}
+
+func watchEventFromStmt(stmt *sqlite.Stmt) *model.WatchEvent {
+	return &model.WatchEvent{
+		Id:        model.NewIdentifier(stmt.GetInt64("id")),
+		UserId:    model.NewIdentifier(stmt.GetInt64("user_id")),
+		TitleId:   model.NewIdentifier(stmt.GetInt64("title_id")),
+		WatchedAt: stmt.GetText("watched_at"),
+		EpisodeId: model.NewIdentifier(stmt.GetInt64("episode_id")),
+		Rating:    stmt.GetFloat("rating"),
+		Source:    stmt.GetText("source"),
+	}
+}
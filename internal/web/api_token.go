@@ -0,0 +1,139 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/auth"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+)
+
+func (s *server) handleGetUserApiTokens(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	tokens, err := repo.GetUserApiTokens(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve API tokens for user `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve API tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&tokens)
+	if err != nil {
+		s.logger.Printf("failed to serialize API tokens: %v", err)
+	}
+}
+
+// handlePostUserApiTokens mints a new API token. The response is the only time the token's value is revealed.
+// When the request is itself made with an API token, the new token can't have any scopes it lacks.
+func (s *server) handlePostUserApiTokens(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	var token *model.ApiToken
+	err = json.NewDecoder(r.Body).Decode(&token)
+	if err != nil || token == nil {
+		s.logger.Printf("malformed API token: %v", err)
+		http.Error(w, "malformed API token", http.StatusBadRequest)
+		return
+	}
+	token.UserId = id
+	token.LastUsedAt = ""
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	if err = token.Validate(); err != nil {
+		s.logger.Printf("malformed API token: %v", err)
+		http.Error(w, "malformed API token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if caller := currentApiToken(r); caller != nil && !caller.Covers(token.Scopes) {
+		s.logger.Printf("API token `%s` may not create a token with scopes %v", caller.Id, token.Scopes)
+		http.Error(w, "an API token may only create tokens with some of its own scopes", http.StatusForbidden)
+		return
+	}
+
+	secret, err := auth.NewToken()
+	if err != nil {
+		s.logger.Printf("failed to generate API token: %v", err)
+		http.Error(w, "failed to create API token", http.StatusInternalServerError)
+		return
+	}
+	token.Token = apiTokenPrefix + secret
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.CreateApiToken(token, auth.HashToken(token.Token))
+	if err != nil {
+		s.logger.Printf("failed to create API token for user `%s`: %v", id, err)
+		http.Error(w, "failed to create API token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&token)
+	if err != nil {
+		s.logger.Printf("failed to serialize API token: %v", err)
+	}
+}
+
+func (s *server) handleDeleteUserApiToken(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+	tokenIdStr := r.PathValue("tokenId")
+	tokenId, err := model.IdentifierFromString(tokenIdStr)
+	if err != nil {
+		s.logger.Printf("invalid token id: `%s`", tokenIdStr)
+		http.Error(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.DeleteApiToken(id, tokenId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchApiToken) {
+			s.logger.Printf("API token not found: `%s`", tokenId)
+			http.Error(w, "API token not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to delete API token `%s`: %v", tokenId, err)
+			http.Error(w, "failed to delete API token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,240 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/auth"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "fwip_session"
+	sessionDuration   = 30 * 24 * time.Hour
+)
+
+// API tokens carry a recognizable prefix so that they are easy to spot if leaked.
+const apiTokenPrefix = "fwip_"
+
+type contextKey int
+
+const principalContextKey contextKey = iota
+
+// A principal is the authenticated user behind a request.
+type principal struct {
+	user *model.User
+	// token is the API token the request was authenticated with, or nil if it used a session.
+	token *model.ApiToken
+}
+
+// A dummy hash to check passwords against when a user doesn't exist, so that logging in as
+// an unknown user takes as long as logging in with the wrong password.
+var dummyPasswordHash, _ = auth.HashPassword("fwip")
+
+// currentUser returns the user making the request, or nil if the request is unauthenticated.
+func currentUser(r *http.Request) *model.User {
+	if p, ok := r.Context().Value(principalContextKey).(*principal); ok {
+		return p.user
+	}
+	return nil
+}
+
+// hasScope reports whether the request is allowed to do something requiring the given scope.
+// Requests authenticated with a session may do anything.
+func hasScope(r *http.Request, scope string) bool {
+	p, ok := r.Context().Value(principalContextKey).(*principal)
+	return ok && (p.token == nil || p.token.HasScope(scope))
+}
+
+// currentApiToken returns the API token the request was authenticated with, or nil if it wasn't made with one.
+func currentApiToken(r *http.Request) *model.ApiToken {
+	if p, ok := r.Context().Value(principalContextKey).(*principal); ok {
+		return p.token
+	}
+	return nil
+}
+
+// authenticate resolves the user making the request from their bearer token or session cookie, if any.
+// A bearer token that doesn't identify anyone is rejected with 401 rather than treated as anonymous, and
+// authenticate returns false once it has responded.
+func (s *server) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		repo := s.repoPool.GetRepository(r.Context())
+		defer s.repoPool.PutRepository(repo)
+
+		user, token, err := repo.UseApiToken(auth.HashToken(bearer))
+		if err != nil {
+			if errors.Is(err, repository.ErrNoSuchApiToken) {
+				s.logger.Printf("invalid API token for %s %s", r.Method, r.URL.Path)
+				http.Error(w, "invalid API token", http.StatusUnauthorized)
+			} else {
+				s.logger.Printf("failed to retrieve API token: %v", err)
+				http.Error(w, "failed to authenticate", http.StatusInternalServerError)
+			}
+			return r, false
+		}
+		return r.WithContext(context.WithValue(r.Context(), principalContextKey, &principal{user: user, token: token})), true
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return r, true
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	user, err := repo.GetSessionUser(auth.HashToken(cookie.Value))
+	if err != nil {
+		if !errors.Is(err, repository.ErrNoSuchSession) {
+			s.logger.Printf("failed to retrieve session: %v", err)
+		}
+		return r, true
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey, &principal{user: user})), true
+}
+
+// requireUser wraps a handler so that it responds 401 to unauthenticated requests,
+// and 403 to requests made with an API token that lacks the given scope.
+func (s *server) requireUser(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if currentUser(r) == nil {
+			s.logger.Printf("unauthenticated request to %s %s", r.Method, r.URL.Path)
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+		if !hasScope(r, scope) {
+			s.logger.Printf("API token lacks scope `%s` for %s %s", scope, r.Method, r.URL.Path)
+			http.Error(w, "API token lacks the `"+scope+"` scope", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// requireAdmin wraps a handler so that, in addition to the checks made by requireUser,
+// it responds 403 to requests from users who aren't admins.
+func (s *server) requireAdmin(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return s.requireUser(scope, func(w http.ResponseWriter, r *http.Request) {
+		if user := currentUser(r); !user.IsAdmin() {
+			s.logger.Printf("user `%s` is not an admin for %s %s", user.Id, r.Method, r.URL.Path)
+			http.Error(w, "only admins may do that", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// requireSelf responds 403 and returns false unless the current user is the user with the given id.
+// The handler must already be wrapped with requireUser.
+func (s *server) requireSelf(w http.ResponseWriter, r *http.Request, userId model.UserId) bool {
+	if user := currentUser(r); user.Id != userId {
+		s.logger.Printf("user `%s` may not act as user `%s`", user.Id, userId)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (s *server) handlePostLogin(w http.ResponseWriter, r *http.Request) {
+	var creds credentials
+	err := json.NewDecoder(r.Body).Decode(&creds)
+	if err != nil {
+		s.logger.Printf("malformed credentials: %v", err)
+		http.Error(w, "malformed credentials", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	passwordHash := dummyPasswordHash
+	user, err := repo.GetUserByUsername(creds.Username)
+	if err == nil {
+		passwordHash, err = repo.GetUserPasswordHash(user.Id)
+	}
+	if err != nil && !errors.Is(err, repository.ErrNoSuchUser) {
+		s.logger.Printf("failed to retrieve user `%s`: %v", creds.Username, err)
+		http.Error(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if passwordHash == "" {
+		// The user has never set a password.
+		passwordHash = dummyPasswordHash
+		user = nil
+	}
+	ok, err := auth.CheckPassword(passwordHash, creds.Password)
+	if err != nil {
+		s.logger.Printf("failed to check password for `%s`: %v", creds.Username, err)
+		http.Error(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if !ok || user == nil {
+		s.logger.Printf("failed login for `%s`", creds.Username)
+		http.Error(w, "incorrect username or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		s.logger.Printf("failed to generate session token: %v", err)
+		http.Error(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(sessionDuration)
+	err = repo.CreateSession(user.Id, auth.HashToken(token), expiresAt)
+	if err != nil {
+		s.logger.Printf("failed to create session for `%s`: %v", user.Id, err)
+		http.Error(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&user)
+	if err != nil {
+		s.logger.Printf("failed to serialize user: %v", err)
+	}
+}
+
+func (s *server) handlePostLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		repo := s.repoPool.GetRepository(r.Context())
+		defer s.repoPool.PutRepository(repo)
+
+		err = repo.DeleteSession(auth.HashToken(cookie.Value))
+		if err != nil {
+			s.logger.Printf("failed to delete session: %v", err)
+			http.Error(w, "failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/binge"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleGetUserBingePlan schedules the rest of the series in the `title` query parameter into the time the
+// `budget` query parameter gives for each day, starting from the `start` date or today. The plan is
+// downloaded as an iCalendar file when `format=ics` is given or the client accepts text/calendar.
+func (s *server) handleGetUserBingePlan(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	titleIdStr := query.Get("title")
+	titleId, err := model.IdentifierFromString(titleIdStr)
+	if err != nil || titleId == model.NoId {
+		s.logger.Printf("invalid title: `%s`", titleIdStr)
+		http.Error(w, "invalid title", http.StatusBadRequest)
+		return
+	}
+	budget, err := binge.ParseBudget(query.Get("budget"))
+	if err != nil {
+		s.logger.Printf("invalid budget: %v", err)
+		http.Error(w, "invalid budget: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	if startStr := query.Get("start"); startStr != "" {
+		start, err = time.Parse(time.DateOnly, startStr)
+		if err != nil {
+			s.logger.Printf("invalid start: `%s`", startStr)
+			http.Error(w, "start must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	// Work in whole days, so that daylight saving time doesn't matter.
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, err = repo.GetUser(id); err != nil {
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			s.logger.Printf("user not found: `%s`", id)
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+		}
+		return
+	}
+	title, err := repo.GetTitle(titleId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchTitle) {
+			s.logger.Printf("title not found: `%s`", titleId)
+			http.Error(w, "title not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve title `%s`: %v", titleId, err)
+			http.Error(w, "failed to retrieve title", http.StatusInternalServerError)
+		}
+		return
+	}
+	if title.Type != model.TitleTypeSeries {
+		s.logger.Printf("title `%s` is not a series", titleId)
+		http.Error(w, "only series can be binged", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := s.bingePlan(repo, id, title, budget, start)
+	if err != nil {
+		if errors.Is(err, binge.ErrNoTime) || errors.Is(err, binge.ErrUnknownRuntime) || errors.Is(err, binge.ErrTooLong) {
+			s.logger.Printf("can't plan title `%s` for user `%s`: %v", titleId, id, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			s.logger.Printf("failed to plan title `%s` for user `%s`: %v", titleId, id, err)
+			http.Error(w, "failed to plan binge", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if query.Get("format") == "ics" || strings.Contains(r.Header.Get("Accept"), "text/calendar") {
+		w.Header().Add("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Add("Content-Disposition", `attachment; filename="binge-plan.ics"`)
+		err = binge.WriteICalendar(w, plan, time.Now())
+		if err != nil {
+			s.logger.Printf("failed to write binge plan calendar: %v", err)
+		}
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&plan)
+	if err != nil {
+		s.logger.Printf("failed to serialize binge plan: %v", err)
+	}
+}
+
+// bingePlan schedules the episodes of the series the user has left and checks the plan against the dates
+// the series leaves its services.
+func (s *server) bingePlan(repo *repository.Repository, userId model.UserId, title *model.Title, budget binge.Budget, start time.Time) (*model.BingePlan, error) {
+	episodes, err := repo.GetUserEpisodesLeft(userId, title.Id)
+	if err != nil {
+		return nil, err
+	}
+	days, err := binge.Schedule(episodes, title.AverageEpisodeRuntime, budget, start)
+	if err != nil {
+		return nil, err
+	}
+	deadlines, err := repo.GetTitleDeadlines(title.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &model.BingePlan{
+		Title:        title,
+		Start:        start.Format(time.DateOnly),
+		EpisodesLeft: int64(len(episodes)),
+		RuntimeLeft:  model.TotalRuntime(episodes, title.AverageEpisodeRuntime),
+		Days:         days,
+		Deadlines:    deadlines,
+	}
+	if len(days) > 0 {
+		plan.FinishDate = days[len(days)-1].Date
+	}
+	for _, deadline := range deadlines {
+		deadline.FinishesInTime = plan.FinishDate <= deadline.AvailableUntil
+	}
+	return plan, nil
+}
@@ -0,0 +1,220 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+)
+
+func (s *server) handlePostChangeRequests(w http.ResponseWriter, r *http.Request) {
+	var changeRequest *model.ChangeRequest
+	err := json.NewDecoder(r.Body).Decode(&changeRequest)
+	if err != nil || changeRequest == nil {
+		s.logger.Printf("malformed change request: %v", err)
+		http.Error(w, "malformed change request", http.StatusBadRequest)
+		return
+	}
+	changeRequest.Id = model.NoId
+	changeRequest.UserId = currentUser(r).Id
+	if err = changeRequest.Validate(); err != nil {
+		s.logger.Printf("malformed change request: %v", err)
+		http.Error(w, "malformed change request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.PutChangeRequest(changeRequest)
+	if err != nil {
+		s.logger.Printf("failed to create change request: %v", err)
+		http.Error(w, "failed to create change request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&changeRequest)
+	if err != nil {
+		s.logger.Printf("failed to serialize change request: %v", err)
+	}
+}
+
+// handleGetChangeRequests lists change requests, optionally only those with the status given by the
+// `status` query parameter.
+func (s *server) handleGetChangeRequests(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.ChangeRequestPending, model.ChangeRequestApproved, model.ChangeRequestRejected:
+	default:
+		s.logger.Printf("invalid status: `%s`", status)
+		http.Error(w, "status must be `pending`, `approved` or `rejected`", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	changeRequests, err := repo.GetChangeRequests(status)
+	if err != nil {
+		s.logger.Printf("failed to retrieve change requests: %v", err)
+		http.Error(w, "failed to retrieve change requests", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&changeRequests)
+	if err != nil {
+		s.logger.Printf("failed to serialize change requests: %v", err)
+	}
+}
+
+func (s *server) handleGetChangeRequest(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	changeRequest, err := repo.GetChangeRequest(id)
+	if err != nil {
+		s.writeChangeRequestError(w, id, err)
+		return
+	}
+	// Members may follow the progress of their own change requests.
+	if user := currentUser(r); !user.IsAdmin() && user.Id != changeRequest.UserId {
+		s.logger.Printf("user `%s` may not view change request `%s`", user.Id, id)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&changeRequest)
+	if err != nil {
+		s.logger.Printf("failed to serialize change request: %v", err)
+	}
+}
+
+// handlePutChangeRequest lets a moderator amend a pending change request before approving it.
+func (s *server) handlePutChangeRequest(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil || id == model.NoId {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	var changeRequest *model.ChangeRequest
+	err = inTransaction(repo, func() error {
+		existing, err := repo.GetChangeRequest(id)
+		if err != nil {
+			s.writeChangeRequestError(w, id, err)
+			return err
+		}
+
+		err = json.NewDecoder(r.Body).Decode(&changeRequest)
+		if err == nil && changeRequest == nil {
+			err = errors.New("missing change request")
+		}
+		if err != nil {
+			s.logger.Printf("malformed change request: %v", err)
+			http.Error(w, "malformed change request", http.StatusBadRequest)
+			return err
+		}
+		// The submitter can't be changed by an amendment.
+		changeRequest.Id = id
+		changeRequest.UserId = existing.UserId
+		if err = changeRequest.Validate(); err != nil {
+			s.logger.Printf("malformed change request: %v", err)
+			http.Error(w, "malformed change request: "+err.Error(), http.StatusBadRequest)
+			return err
+		}
+
+		_, err = repo.PutChangeRequest(changeRequest)
+		if err != nil {
+			s.writeChangeRequestError(w, id, err)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&changeRequest)
+	if err != nil {
+		s.logger.Printf("failed to serialize change request: %v", err)
+	}
+}
+
+func (s *server) handlePostChangeRequestApprove(w http.ResponseWriter, r *http.Request) {
+	s.resolveChangeRequest(w, r, (*repository.Repository).ApproveChangeRequest)
+}
+
+func (s *server) handlePostChangeRequestReject(w http.ResponseWriter, r *http.Request) {
+	s.resolveChangeRequest(w, r, (*repository.Repository).RejectChangeRequest)
+}
+
+// resolveChangeRequest approves or rejects the change request identified in the path using resolve.
+func (s *server) resolveChangeRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	resolve func(*repository.Repository, model.Identifier) (*model.ChangeRequest, error),
+) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	changeRequest, err := resolve(repo, id)
+	if err != nil {
+		s.writeChangeRequestError(w, id, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&changeRequest)
+	if err != nil {
+		s.logger.Printf("failed to serialize change request: %v", err)
+	}
+}
+
+// writeChangeRequestError responds to a failed attempt to retrieve, amend or resolve a change request.
+// Errors from applying the change mean the catalog has moved on since the request was made, so they
+// are reported as conflicts.
+func (s *server) writeChangeRequestError(w http.ResponseWriter, id model.Identifier, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNoSuchChangeRequest):
+		s.logger.Printf("change request not found: `%s`", id)
+		http.Error(w, "change request not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrChangeRequestResolved),
+		errors.Is(err, repository.ErrNoSuchTitle),
+		errors.Is(err, repository.ErrNoSuchService),
+		errors.Is(err, repository.ErrNoSuchServiceTitle),
+		errors.Is(err, repository.ErrNoSuchPerson),
+		errors.Is(err, repository.ErrDuplicateCredit),
+		errors.Is(err, repository.ErrDuplicateTitle):
+		s.logger.Printf("cannot apply change request `%s`: %v", id, err)
+		http.Error(w, "cannot apply change request: "+err.Error(), http.StatusConflict)
+	default:
+		s.logger.Printf("failed to process change request `%s`: %v", id, err)
+		http.Error(w, "failed to process change request", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+	"strconv"
+)
+
+func (s *server) handleGetTitleSeasons(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if !s.requireTitle(w, repo, id) {
+		return
+	}
+	seasons, err := repo.GetTitleSeasons(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve seasons for title `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve seasons", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&seasons)
+	if err != nil {
+		s.logger.Printf("failed to serialize seasons: %v", err)
+	}
+}
+
+// handleGetTitleEpisodes lists a series' episodes in order. The `season` query parameter limits them to
+// the season with that number.
+func (s *server) handleGetTitleEpisodes(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var seasonNumber *int64
+	if seasonStr := r.URL.Query().Get("season"); seasonStr != "" {
+		number, err := strconv.ParseInt(seasonStr, 10, 64)
+		if err != nil {
+			s.logger.Printf("invalid season: `%s`", seasonStr)
+			http.Error(w, "invalid season", http.StatusBadRequest)
+			return
+		}
+		seasonNumber = &number
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if !s.requireTitle(w, repo, id) {
+		return
+	}
+	episodes, err := repo.GetTitleEpisodes(id, seasonNumber)
+	if err != nil {
+		s.logger.Printf("failed to retrieve episodes for title `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve episodes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&episodes)
+	if err != nil {
+		s.logger.Printf("failed to serialize episodes: %v", err)
+	}
+}
+
+// handlePutTitleSeason saves a season of a series along with all of its episodes.
+func (s *server) handlePutTitleSeason(w http.ResponseWriter, r *http.Request) {
+	id, number, ok := s.parseSeasonPath(w, r)
+	if !ok {
+		return
+	}
+
+	var season *model.Season
+	err := json.NewDecoder(r.Body).Decode(&season)
+	if err != nil || season == nil {
+		s.logger.Printf("malformed season: %v", err)
+		http.Error(w, "malformed season", http.StatusBadRequest)
+		return
+	}
+	season.Id = model.NoId
+	season.TitleId = id
+	season.Number = number
+	if season.Episodes == nil {
+		season.Episodes = []*model.Episode{}
+	}
+	if err = season.Validate(); err != nil {
+		s.logger.Printf("malformed season: %v", err)
+		http.Error(w, "malformed season: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.PutSeason(season)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNoSuchTitle):
+			s.logger.Printf("title not found: `%s`", id)
+			http.Error(w, "title not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrNotSeries):
+			s.logger.Printf("title `%s` is not a series", id)
+			http.Error(w, "only series have seasons", http.StatusBadRequest)
+		default:
+			s.logger.Printf("failed to save season %d of title `%s`: %v", number, id, err)
+			http.Error(w, "failed to save season", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&season)
+	if err != nil {
+		s.logger.Printf("failed to serialize season: %v", err)
+	}
+}
+
+func (s *server) handleDeleteTitleSeason(w http.ResponseWriter, r *http.Request) {
+	id, number, ok := s.parseSeasonPath(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err := repo.DeleteSeason(id, number)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchSeason) {
+			s.logger.Printf("season %d of title `%s` not found", number, id)
+			http.Error(w, "season not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to delete season %d of title `%s`: %v", number, id, err)
+			http.Error(w, "failed to delete season", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireTitle responds with an error if there is no such title.
+func (s *server) requireTitle(w http.ResponseWriter, repo *repository.Repository, id model.TitleId) bool {
+	_, err := repo.GetTitle(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchTitle) {
+			s.logger.Printf("title not found: `%s`", id)
+			http.Error(w, "title not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve title `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve title", http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
+// parseSeasonPath reads the title ID and season number from the path, responding with an error if either
+// is invalid.
+func (s *server) parseSeasonPath(w http.ResponseWriter, r *http.Request) (id model.TitleId, number int64, ok bool) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	numberStr := r.PathValue("number")
+	number, err = strconv.ParseInt(numberStr, 10, 64)
+	if err != nil || number < 0 {
+		s.logger.Printf("invalid season number: `%s`", numberStr)
+		http.Error(w, "invalid season number", http.StatusBadRequest)
+		return
+	}
+	return id, number, true
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/pick"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// handleGetUserFwip picks a title for the user to watch.
+// The pick can be narrowed with the `service`, `type` and `max_runtime` query parameters,
+// and limited to the titles in one of the user's smart lists with the `smart_list` query parameter.
+// The `strategy` query parameter overrides the user's preferred pick strategy.
+func (s *server) handleGetUserFwip(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	criteria, ok := s.parsePickCriteria(w, r)
+	if !ok {
+		return
+	}
+	criteria.UserIds = []model.UserId{id}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	user, err := repo.GetUser(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			s.logger.Printf("user not found: `%s`", id)
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if smartListIdStr := r.URL.Query().Get("smart_list"); smartListIdStr != "" {
+		smartListId, err := model.IdentifierFromString(smartListIdStr)
+		if err != nil {
+			s.logger.Printf("invalid smart list id: `%s`", smartListIdStr)
+			http.Error(w, "invalid smart list id", http.StatusBadRequest)
+			return
+		}
+		criteria.Expr, ok = s.smartListFilter(w, repo, id, smartListId)
+		if !ok {
+			return
+		}
+	}
+
+	strategy := r.URL.Query().Get("strategy")
+	if strategy == "" {
+		strategy = user.PickStrategy
+	}
+	s.pickTitle(w, repo, criteria, strategy)
+}
+
+// handleGetGroupFwip picks a title that none of the users listed in the `users` query parameter have watched.
+// Titles that several of the users want to watch are more likely to be picked.
+// It accepts the same query parameters as handleGetUserFwip.
+func (s *server) handleGetGroupFwip(w http.ResponseWriter, r *http.Request) {
+	usersStr := r.URL.Query().Get("users")
+	if usersStr == "" {
+		s.logger.Printf("missing users")
+		http.Error(w, "missing users", http.StatusBadRequest)
+		return
+	}
+
+	criteria, ok := s.parsePickCriteria(w, r)
+	if !ok {
+		return
+	}
+	seen := make(map[model.UserId]bool)
+	for _, idStr := range strings.Split(usersStr, ",") {
+		id, err := model.IdentifierFromString(strings.TrimSpace(idStr))
+		if err != nil {
+			s.logger.Printf("invalid user id: `%s`", idStr)
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			criteria.UserIds = append(criteria.UserIds, id)
+		}
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	for _, id := range criteria.UserIds {
+		_, err := repo.GetUser(id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNoSuchUser) {
+				s.logger.Printf("user not found: `%s`", id)
+				http.Error(w, "user not found: "+id.String(), http.StatusNotFound)
+			} else {
+				s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+				http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	s.pickTitle(w, repo, criteria, r.URL.Query().Get("strategy"))
+}
+
+// parsePickCriteria reads the filters shared by the pick endpoints from the query string,
+// responding with an error if any of them are invalid.
+func (s *server) parsePickCriteria(w http.ResponseWriter, r *http.Request) (criteria repository.PickCriteria, ok bool) {
+	var err error
+	query := r.URL.Query()
+	if serviceIdStr := query.Get("service"); serviceIdStr != "" {
+		criteria.ServiceId, err = model.IdentifierFromString(serviceIdStr)
+		if err != nil {
+			s.logger.Printf("invalid service id: `%s`", serviceIdStr)
+			http.Error(w, "invalid service id", http.StatusBadRequest)
+			return
+		}
+	}
+	if titleType := query.Get("type"); titleType != "" {
+		if titleType != model.TitleTypeMovie && titleType != model.TitleTypeSeries {
+			s.logger.Printf("invalid type: `%s`", titleType)
+			http.Error(w, "type must be `movie` or `series`", http.StatusBadRequest)
+			return
+		}
+		criteria.Type = titleType
+	}
+	if maxRuntimeStr := query.Get("max_runtime"); maxRuntimeStr != "" {
+		criteria.MaxRuntime, err = strconv.ParseInt(maxRuntimeStr, 10, 64)
+		if err != nil || criteria.MaxRuntime < 1 {
+			s.logger.Printf("invalid max_runtime: `%s`", maxRuntimeStr)
+			http.Error(w, "max_runtime must be a positive number of minutes", http.StatusBadRequest)
+			return
+		}
+	}
+	return criteria, true
+}
+
+// pickTitle picks a title using the named strategy, or the default strategy if none is named, and writes it
+// to the response.
+func (s *server) pickTitle(
+	w http.ResponseWriter,
+	repo *repository.Repository,
+	criteria repository.PickCriteria,
+	strategy string,
+) {
+	if strategy == "" {
+		strategy = pick.Default
+	}
+	picker, err := pick.Get(strategy)
+	if err != nil {
+		s.logger.Printf("invalid strategy: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	title, err := picker.Pick(repo, criteria)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoCandidates) {
+			s.logger.Printf("no titles to pick for users %v", criteria.UserIds)
+			http.Error(w, "no titles match", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to pick title for users %v: %v", criteria.UserIds, err)
+			http.Error(w, "failed to pick title", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&title)
+	if err != nil {
+		s.logger.Printf("failed to serialize title: %v", err)
+	}
+}
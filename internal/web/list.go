@@ -0,0 +1,403 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"math"
+	"net/http"
+)
+
+// A listItemRequest adds a title to a list. The title is added at the end if the position is omitted.
+type listItemRequest struct {
+	TitleId  model.TitleId `json:"title_id"`
+	Position *int64        `json:"position"`
+}
+
+const listOpMove = "move"
+
+// A listItemsPatch changes the order of a list's items. The only operation is `move`,
+// which moves a title to a new position and shifts the items in between.
+type listItemsPatch struct {
+	Op      string        `json:"op"`
+	TitleId model.TitleId `json:"title_id"`
+	To      int64         `json:"to"`
+}
+
+// handleGetUserLists lists the lists a user owns or is a member of. Only the user may see them; anybody else
+// needs a share link.
+func (s *server) handleGetUserLists(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	lists, err := repo.GetUserLists(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve lists for user `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve lists", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&lists)
+	if err != nil {
+		s.logger.Printf("failed to serialize lists: %v", err)
+	}
+}
+
+func (s *server) handlePostLists(w http.ResponseWriter, r *http.Request) {
+	var list *model.List
+	err := json.NewDecoder(r.Body).Decode(&list)
+	if err != nil || list == nil {
+		s.logger.Printf("malformed list: %v", err)
+		http.Error(w, "malformed list", http.StatusBadRequest)
+		return
+	}
+	list.Id = model.NoId
+	list.UserId = currentUser(r).Id
+	list.Items = nil
+	if err = list.Validate(); err != nil {
+		s.logger.Printf("malformed list: %v", err)
+		http.Error(w, "malformed list: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.CreateList(list)
+	if err != nil {
+		s.logger.Printf("failed to create list: %v", err)
+		http.Error(w, "failed to create list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&list)
+	if err != nil {
+		s.logger.Printf("failed to serialize list: %v", err)
+	}
+}
+
+func (s *server) handleGetList(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	list, ok := s.requireListEditor(w, r, repo, id)
+	if !ok {
+		return
+	}
+	items, err := repo.GetListItems(id)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+	list.Items = items
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&list)
+	if err != nil {
+		s.logger.Printf("failed to serialize list: %v", err)
+	}
+}
+
+func (s *server) handleDeleteList(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, ok = s.requireListOwner(w, r, repo, id); !ok {
+		return
+	}
+	err := repo.DeleteList(id)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePutListMember lets another user change the list's items. Only the owner may add members.
+func (s *server) handlePutListMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+	userIdStr := r.PathValue("userId")
+	userId, err := model.IdentifierFromString(userIdStr)
+	if err != nil {
+		s.logger.Printf("invalid user id: `%s`", userIdStr)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	list, ok := s.requireListOwner(w, r, repo, id)
+	if !ok {
+		return
+	}
+	if userId == list.UserId {
+		s.logger.Printf("user `%s` already owns list `%s`", userId, id)
+		http.Error(w, "the owner of a list can't be a member of it", http.StatusBadRequest)
+		return
+	}
+	if _, err = repo.GetUser(userId); err != nil {
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			s.logger.Printf("user not found: `%s`", userId)
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve user `%s`: %v", userId, err)
+			http.Error(w, "failed to add list member", http.StatusInternalServerError)
+		}
+		return
+	}
+	err = repo.AddListMember(id, userId)
+	if err != nil && !errors.Is(err, repository.ErrDuplicateListMember) {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleDeleteListMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+	userIdStr := r.PathValue("userId")
+	userId, err := model.IdentifierFromString(userIdStr)
+	if err != nil {
+		s.logger.Printf("invalid user id: `%s`", userIdStr)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	// Members may leave a list, but only the owner may remove anyone else.
+	if currentUser(r).Id != userId {
+		if _, ok = s.requireListOwner(w, r, repo, id); !ok {
+			return
+		}
+	}
+	err = repo.RemoveListMember(id, userId)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handlePostListItems(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+	var req listItemRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		s.logger.Printf("malformed list item: %v", err)
+		http.Error(w, "malformed list item", http.StatusBadRequest)
+		return
+	}
+	item := &model.ListItem{TitleId: req.TitleId, Position: math.MaxInt64, AddedBy: currentUser(r).Id}
+	if req.Position != nil {
+		item.Position = *req.Position
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, ok = s.requireListEditor(w, r, repo, id); !ok {
+		return
+	}
+	err = repo.AddListItem(id, item)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&item)
+	if err != nil {
+		s.logger.Printf("failed to serialize list item: %v", err)
+	}
+}
+
+func (s *server) handleDeleteListItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+	titleIdStr := r.PathValue("titleId")
+	titleId, err := model.IdentifierFromString(titleIdStr)
+	if err != nil {
+		s.logger.Printf("invalid title id: `%s`", titleIdStr)
+		http.Error(w, "invalid title id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, ok = s.requireListEditor(w, r, repo, id); !ok {
+		return
+	}
+	err = repo.RemoveListItem(id, titleId)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePatchListItems reorders a list's items, responding with the list in its new order.
+func (s *server) handlePatchListItems(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.parseListId(w, r)
+	if !ok {
+		return
+	}
+	var patch listItemsPatch
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		s.logger.Printf("malformed list patch: %v", err)
+		http.Error(w, "malformed list patch", http.StatusBadRequest)
+		return
+	}
+	if patch.Op != listOpMove {
+		s.logger.Printf("unknown list operation: `%s`", patch.Op)
+		http.Error(w, "unknown list operation: `"+patch.Op+"`", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	list, ok := s.requireListEditor(w, r, repo, id)
+	if !ok {
+		return
+	}
+	_, err = repo.MoveListItem(id, patch.TitleId, patch.To)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+	list.Items, err = repo.GetListItems(id)
+	if err != nil {
+		s.writeCuratedListError(w, id, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&list)
+	if err != nil {
+		s.logger.Printf("failed to serialize list: %v", err)
+	}
+}
+
+// requireListOwner retrieves a list, responding with an error and returning false
+// unless the current user owns it.
+func (s *server) requireListOwner(
+	w http.ResponseWriter,
+	r *http.Request,
+	repo *repository.Repository,
+	listId model.Identifier,
+) (*model.List, bool) {
+	list, err := repo.GetList(listId)
+	if err != nil {
+		s.writeCuratedListError(w, listId, err)
+		return nil, false
+	}
+	if user := currentUser(r); user.Id != list.UserId {
+		s.logger.Printf("user `%s` does not own list `%s`", user.Id, listId)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return list, true
+}
+
+// requireListEditor retrieves a list, responding with an error and returning false
+// unless the current user owns it or is one of its members. Only they may see the list or change its items.
+func (s *server) requireListEditor(
+	w http.ResponseWriter,
+	r *http.Request,
+	repo *repository.Repository,
+	listId model.Identifier,
+) (*model.List, bool) {
+	list, err := repo.GetList(listId)
+	if err != nil {
+		s.writeCuratedListError(w, listId, err)
+		return nil, false
+	}
+	if user := currentUser(r); !list.CanEdit(user.Id) {
+		s.logger.Printf("user `%s` may not access list `%s`", user.Id, listId)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return list, true
+}
+
+func (s *server) parseListId(w http.ResponseWriter, r *http.Request) (model.Identifier, bool) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return model.NoId, false
+	}
+	return id, true
+}
+
+// writeCuratedListError responds to an error from a repository method changing or retrieving a list.
+// Not to be confused with writeListError, which handles errors retrieving pages of things.
+func (s *server) writeCuratedListError(w http.ResponseWriter, listId model.Identifier, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNoSuchList):
+		s.logger.Printf("list not found: `%s`", listId)
+		http.Error(w, "list not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrNoSuchListItem):
+		s.logger.Printf("title not on list `%s`", listId)
+		http.Error(w, "title is not on the list", http.StatusNotFound)
+	case errors.Is(err, repository.ErrNoSuchListMember):
+		s.logger.Printf("user not a member of list `%s`", listId)
+		http.Error(w, "user is not a member of the list", http.StatusNotFound)
+	case errors.Is(err, repository.ErrNoSuchTitle):
+		s.logger.Printf("title not found for list `%s`", listId)
+		http.Error(w, "title not found", http.StatusBadRequest)
+	case errors.Is(err, repository.ErrDuplicateListItem):
+		s.logger.Printf("title already on list `%s`", listId)
+		http.Error(w, "title is already on the list", http.StatusConflict)
+	default:
+		s.logger.Printf("failed to process list `%s`: %v", listId, err)
+		http.Error(w, "failed to process list", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"errors"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// A listResponse is the envelope every paged list is returned in. NextCursor is passed as the `cursor`
+// query parameter to get the next page, and is empty on the last page.
+type listResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func newListResponse[T any](items []T, next *repository.Cursor) *listResponse[T] {
+	response := &listResponse[T]{Items: items}
+	if next != nil {
+		response.NextCursor = next.String()
+	}
+	return response
+}
+
+// parsePage reads the `limit` and `cursor` query parameters.
+func parsePage(query url.Values) (page repository.Page, err error) {
+	page.Limit = defaultPageLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		page.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || page.Limit < 1 || page.Limit > maxPageLimit {
+			return page, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		page.After, err = repository.ParseCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+// writeListError responds to a failed attempt to retrieve a page of a list.
+func (s *server) writeListError(w http.ResponseWriter, what string, err error) {
+	if errors.Is(err, repository.ErrMalformedCursor) || errors.Is(err, repository.ErrCursorMismatch) {
+		s.logger.Printf("invalid cursor for %s: %v", what, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.logger.Printf("failed to retrieve %s: %v", what, err)
+	http.Error(w, "failed to retrieve "+what, http.StatusInternalServerError)
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/expr"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseDays parses a span of days written like `14d` or `2w`.
+func parseDays(value string) (int, error) {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "d"):
+		value = strings.TrimSuffix(value, "d")
+	case strings.HasSuffix(value, "w"):
+		value = strings.TrimSuffix(value, "w")
+		multiplier = 7
+	default:
+		return 0, errors.New("expected a number of days or weeks, like `14d` or `2w`")
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, errors.New("expected a positive number of days or weeks, like `14d` or `2w`")
+	}
+	return n * multiplier, nil
+}
+
+// parseTitleFilter reads the filters accepted by handleGetTitles from the query string.
+func parseTitleFilter(query url.Values) (filter repository.TitleFilter, err error) {
+	for _, serviceIdStr := range query["service"] {
+		serviceId, err := model.IdentifierFromString(serviceIdStr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid service id `%s`", serviceIdStr)
+		}
+		filter.ServiceIds = append(filter.ServiceIds, serviceId)
+	}
+	filter.Genre = query.Get("genre")
+	filter.Query = query.Get("q")
+	if filter.Expr, err = expr.Parse(query.Get("filter")); err != nil {
+		return filter, fmt.Errorf("invalid filter: %w", err)
+	}
+	filter.Type = query.Get("type")
+	if filter.Type != "" && filter.Type != model.TitleTypeMovie && filter.Type != model.TitleTypeSeries {
+		return filter, errors.New("type must be `movie` or `series`")
+	}
+	if filter.YearMin, err = parseOptionalPositiveInt(query, "year_min"); err != nil {
+		return
+	}
+	if filter.YearMax, err = parseOptionalPositiveInt(query, "year_max"); err != nil {
+		return
+	}
+	filter.RuntimeMax, err = parseOptionalPositiveInt(query, "runtime_max")
+	return
+}
+
+// parseTitleSort parses a sort like `year` or `-year`. An empty sort orders searches by relevance and
+// everything else by name.
+func parseTitleSort(value string, isSearch bool) (repository.TitleSort, error) {
+	var sort repository.TitleSort
+	sort.Key, sort.Descending = strings.CutPrefix(value, "-")
+	switch sort.Key {
+	case "":
+		if sort.Descending {
+			break
+		}
+		sort.Key = repository.TitleSortName
+		if isSearch {
+			sort.Key = repository.TitleSortRelevance
+		}
+		return sort, nil
+	case repository.TitleSortName, repository.TitleSortYear, repository.TitleSortReleaseDate, repository.TitleSortRuntime:
+		return sort, nil
+	}
+	return sort, errors.New("sort must be `name`, `year`, `release_date` or `runtime`, optionally preceded by `-`")
+}
+
+// parseOptionalPositiveInt parses the named query parameter as a positive integer, or returns 0 if it's missing.
+func parseOptionalPositiveInt(query url.Values, name string) (int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
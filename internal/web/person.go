@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+)
+
+// handleGetPeople lists the people whose names contain the `q` query parameter.
+func (s *server) handleGetPeople(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	people, next, err := repo.SearchPeople(r.URL.Query().Get("q"), page)
+	if err != nil {
+		s.writeListError(w, "people", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newListResponse(people, next))
+	if err != nil {
+		s.logger.Printf("failed to serialize people: %v", err)
+	}
+}
+
+func (s *server) handleGetPerson(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	person, err := repo.GetPerson(id)
+	if err != nil {
+		s.writePersonError(w, id, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&person)
+	if err != nil {
+		s.logger.Printf("failed to serialize person: %v", err)
+	}
+}
+
+// handleGetPersonTitles lists the titles a person is credited on, with their role on each.
+func (s *server) handleGetPersonTitles(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	// Distinguish a missing person from one without any credits.
+	_, err = repo.GetPerson(id)
+	if err != nil {
+		s.writePersonError(w, id, err)
+		return
+	}
+	credits, next, err := repo.GetPersonCredits(id, page)
+	if err != nil {
+		s.writeListError(w, "titles", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newListResponse(credits, next))
+	if err != nil {
+		s.logger.Printf("failed to serialize credits: %v", err)
+	}
+}
+
+func (s *server) writePersonError(w http.ResponseWriter, id model.Identifier, err error) {
+	if errors.Is(err, repository.ErrNoSuchPerson) {
+		s.logger.Printf("person not found: `%s`", id)
+		http.Error(w, "person not found", http.StatusNotFound)
+	} else {
+		s.logger.Printf("failed to retrieve person `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve person", http.StatusInternalServerError)
+	}
+}
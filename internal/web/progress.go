@@ -0,0 +1,119 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+)
+
+// handlePutUserWatchedEpisode marks an episode as watched. Marking an episode the user has already watched
+// changes nothing; use watch events to record watching it again.
+func (s *server) handlePutUserWatchedEpisode(w http.ResponseWriter, r *http.Request) {
+	id, episodeId, ok := s.parseWatchedEpisodePath(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err := repo.MarkEpisodeWatched(id, episodeId)
+	if err != nil {
+		s.writeWatchedEpisodeError(w, episodeId, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteUserWatchedEpisode marks an episode as unwatched, deleting the user's watch events for it.
+func (s *server) handleDeleteUserWatchedEpisode(w http.ResponseWriter, r *http.Request) {
+	id, episodeId, ok := s.parseWatchedEpisodePath(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err := repo.UnmarkEpisodeWatched(id, episodeId)
+	if err != nil {
+		s.writeWatchedEpisodeError(w, episodeId, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetUserNextUp lists the next episode to watch of each series the user is part way through.
+func (s *server) handleGetUserNextUp(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, err = repo.GetUser(id); err != nil {
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			s.logger.Printf("user not found: `%s`", id)
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	nextUps, err := repo.GetUserNextUp(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve next up for user `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve next up", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&nextUps)
+	if err != nil {
+		s.logger.Printf("failed to serialize next up: %v", err)
+	}
+}
+
+// parseWatchedEpisodePath reads the user and episode IDs from the path, responding with an error if either
+// is invalid or the user isn't the one logged in.
+func (s *server) parseWatchedEpisodePath(w http.ResponseWriter, r *http.Request) (id model.UserId, episodeId model.Identifier, ok bool) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+	episodeIdStr := r.PathValue("episodeId")
+	episodeId, err = model.IdentifierFromString(episodeIdStr)
+	if err != nil {
+		s.logger.Printf("invalid episode id: `%s`", episodeIdStr)
+		http.Error(w, "invalid episode id", http.StatusBadRequest)
+		return
+	}
+	return id, episodeId, true
+}
+
+func (s *server) writeWatchedEpisodeError(w http.ResponseWriter, episodeId model.Identifier, err error) {
+	if errors.Is(err, repository.ErrNoSuchEpisode) {
+		s.logger.Printf("episode not found: `%s`", episodeId)
+		http.Error(w, "episode not found", http.StatusNotFound)
+		return
+	}
+	s.logger.Printf("failed to update watched episode `%s`: %v", episodeId, err)
+	http.Error(w, "failed to update watched episode", http.StatusInternalServerError)
+}
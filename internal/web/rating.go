@@ -0,0 +1,143 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+)
+
+// handleGetUserRatings lists a page of the user's ratings, the most recently changed first.
+func (s *server) handleGetUserRatings(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, err = repo.GetUser(id); err != nil {
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			s.logger.Printf("user not found: `%s`", id)
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ratings, next, err := repo.GetUserRatings(id, page)
+	if err != nil {
+		s.writeListError(w, "ratings", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newListResponse(ratings, next))
+	if err != nil {
+		s.logger.Printf("failed to serialize ratings: %v", err)
+	}
+}
+
+// handlePutUserRating rates a title, replacing the user's earlier rating and review of it.
+func (s *server) handlePutUserRating(w http.ResponseWriter, r *http.Request) {
+	id, titleId, ok := s.parseRatingPath(w, r)
+	if !ok {
+		return
+	}
+
+	var rating *model.Rating
+	err := json.NewDecoder(r.Body).Decode(&rating)
+	if err != nil || rating == nil {
+		s.logger.Printf("malformed rating: %v", err)
+		http.Error(w, "malformed rating", http.StatusBadRequest)
+		return
+	}
+	rating.UserId = id
+	rating.TitleId = titleId
+	if err = rating.Validate(); err != nil {
+		s.logger.Printf("malformed rating: %v", err)
+		http.Error(w, "malformed rating: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.PutRating(rating)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchTitle) {
+			s.logger.Printf("title not found: `%s`", titleId)
+			http.Error(w, "title not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to save rating of title `%s` for user `%s`: %v", titleId, id, err)
+			http.Error(w, "failed to save rating", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&rating)
+	if err != nil {
+		s.logger.Printf("failed to serialize rating: %v", err)
+	}
+}
+
+func (s *server) handleDeleteUserRating(w http.ResponseWriter, r *http.Request) {
+	id, titleId, ok := s.parseRatingPath(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err := repo.DeleteRating(id, titleId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchRating) {
+			s.logger.Printf("rating of title `%s` not found for user `%s`", titleId, id)
+			http.Error(w, "rating not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to delete rating of title `%s` for user `%s`: %v", titleId, id, err)
+			http.Error(w, "failed to delete rating", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseRatingPath reads the user and title IDs from the path, responding with an error if either is invalid
+// or the user isn't the one logged in.
+func (s *server) parseRatingPath(w http.ResponseWriter, r *http.Request) (id model.UserId, titleId model.TitleId, ok bool) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+	titleIdStr := r.PathValue("titleId")
+	titleId, err = model.IdentifierFromString(titleIdStr)
+	if err != nil {
+		s.logger.Printf("invalid title id: `%s`", titleIdStr)
+		http.Error(w, "invalid title id", http.StatusBadRequest)
+		return
+	}
+	return id, titleId, true
+}
@@ -0,0 +1,250 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/auth"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var sharedViewTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+    <head>
+        <meta charset="utf-8">
+        <title>{{.Name}} - {{.Username}} - FWIP!</title>
+        <link rel="stylesheet" href="/style.css">
+    </head>
+
+    <body>
+        <h1>{{.Name}}</h1>
+        <p>Shared by {{.Username}}</p>
+        {{- with .Description}}
+        <p>{{.}}</p>
+        {{- end}}
+        {{- if .Titles}}
+        <ol>
+            {{- range .Titles}}
+            <li>{{.Name}}{{if .Year}} ({{.Year}}){{end}}</li>
+            {{- end}}
+        </ol>
+        {{- else}}
+        <p>Nothing here yet.</p>
+        {{- end}}
+    </body>
+</html>
+`))
+
+// Names of the sets of titles that aren't lists.
+var sharedViewNames = map[string]string{
+	model.ShareKindWatched:     "Watched",
+	model.ShareKindWantToWatch: "Want to watch",
+}
+
+// handleGetUserShareLinks lists the user's share links, along with those members made to the user's lists.
+func (s *server) handleGetUserShareLinks(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	links, err := repo.GetUserShareLinks(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve share links for user `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve share links", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&links)
+	if err != nil {
+		s.logger.Printf("failed to serialize share links: %v", err)
+	}
+}
+
+// handlePostUserShareLinks creates a share link for one of the user's lists, or for the titles they've watched
+// or want to watch. Members of a list may share it as well as its owner. The response is the only time the
+// link's token is revealed.
+func (s *server) handlePostUserShareLinks(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	var link *model.ShareLink
+	err = json.NewDecoder(r.Body).Decode(&link)
+	if err != nil || link == nil {
+		s.logger.Printf("malformed share link: %v", err)
+		http.Error(w, "malformed share link", http.StatusBadRequest)
+		return
+	}
+	link.Id = model.NoId
+	link.UserId = id
+	if err = link.Validate(); err != nil {
+		s.logger.Printf("malformed share link: %v", err)
+		http.Error(w, "malformed share link: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	link.Token, err = auth.NewShareToken()
+	if err != nil {
+		s.logger.Printf("failed to generate share token: %v", err)
+		http.Error(w, "failed to create share link", http.StatusInternalServerError)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if link.Kind == model.ShareKindList {
+		if _, ok := s.requireListEditor(w, r, repo, link.ListId); !ok {
+			return
+		}
+	}
+	_, err = repo.CreateShareLink(link, auth.HashToken(link.Token))
+	if err != nil {
+		s.logger.Printf("failed to create share link for user `%s`: %v", id, err)
+		http.Error(w, "failed to create share link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&link)
+	if err != nil {
+		s.logger.Printf("failed to serialize share link: %v", err)
+	}
+}
+
+// handleDeleteUserShareLink revokes one of the user's share links. The owner of a list may also revoke the
+// links its members made to it.
+func (s *server) handleDeleteUserShareLink(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+	linkIdStr := r.PathValue("linkId")
+	linkId, err := model.IdentifierFromString(linkIdStr)
+	if err != nil {
+		s.logger.Printf("invalid share link id: `%s`", linkIdStr)
+		http.Error(w, "invalid share link id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.DeleteShareLink(id, linkId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchShareLink) {
+			s.logger.Printf("share link not found: `%s`", linkId)
+			http.Error(w, "share link not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to delete share link `%s`: %v", linkId, err)
+			http.Error(w, "failed to delete share link", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetShare shows what a share link points to, without requiring a login. It is the only way for somebody
+// who isn't logged in to see a user's lists or what they have watched. Browsers asking for HTML get a page
+// listing the titles, and anything else gets JSON.
+func (s *server) handleGetShare(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	link, err := repo.GetShareLinkByToken(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchShareLink) {
+			s.logger.Printf("share link not found")
+			http.Error(w, "share link not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve share link: %v", err)
+			http.Error(w, "failed to retrieve share link", http.StatusInternalServerError)
+		}
+		return
+	}
+	view, err := s.sharedView(repo, link)
+	if err != nil {
+		s.logger.Printf("failed to retrieve share link `%s`: %v", link.Id, err)
+		http.Error(w, "failed to retrieve share link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		err = sharedViewTemplate.Execute(w, view)
+		if err != nil {
+			s.logger.Printf("failed to render share link: %v", err)
+		}
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&view)
+	if err != nil {
+		s.logger.Printf("failed to serialize share link: %v", err)
+	}
+}
+
+// sharedView retrieves the titles a share link points to.
+func (s *server) sharedView(repo *repository.Repository, link *model.ShareLink) (*model.SharedView, error) {
+	owner, err := repo.GetUser(link.UserId)
+	if err != nil {
+		return nil, err
+	}
+	view := &model.SharedView{Kind: link.Kind, Username: owner.Username, Name: sharedViewNames[link.Kind]}
+	switch link.Kind {
+	case model.ShareKindList:
+		list, err := repo.GetList(link.ListId)
+		if err != nil {
+			return nil, err
+		}
+		items, err := repo.GetListItems(link.ListId)
+		if err != nil {
+			return nil, err
+		}
+		view.Name = list.Name
+		view.Description = list.Description
+		view.Titles = make([]*model.Title, len(items))
+		for i, item := range items {
+			view.Titles[i] = item.Title
+		}
+	case model.ShareKindWatched:
+		view.Titles, err = repo.GetWatchedTitles(link.UserId)
+	case model.ShareKindWantToWatch:
+		view.Titles, err = repo.GetWantedTitles(link.UserId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
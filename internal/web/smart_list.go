@@ -0,0 +1,273 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/expr"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+)
+
+func (s *server) handleGetUserSmartLists(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	smartLists, err := repo.GetUserSmartLists(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve smart lists for user `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve smart lists", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&smartLists)
+	if err != nil {
+		s.logger.Printf("failed to serialize smart lists: %v", err)
+	}
+}
+
+func (s *server) handlePostUserSmartLists(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	var smartList *model.SmartList
+	err = json.NewDecoder(r.Body).Decode(&smartList)
+	if err != nil || smartList == nil {
+		s.logger.Printf("malformed smart list: %v", err)
+		http.Error(w, "malformed smart list", http.StatusBadRequest)
+		return
+	}
+	smartList.Id = model.NoId
+	smartList.UserId = id
+	if err = smartList.Validate(); err != nil {
+		s.logger.Printf("malformed smart list: %v", err)
+		http.Error(w, "malformed smart list: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	// Check that any users the filter names exist, without changing how it was written. They're saved by ID,
+	// so that the list keeps working if they're renamed.
+	node, _ := expr.Parse(smartList.Filter)
+	userIds, ok := s.resolveFilterUsers(w, repo, node, currentUser(r))
+	if !ok {
+		return
+	}
+	smartList.UserIds = userIds
+
+	_, err = repo.CreateSmartList(smartList)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateSmartList) {
+			s.logger.Printf("duplicate smart list name: `%s`", smartList.Name)
+			http.Error(w, "a smart list with that name already exists", http.StatusConflict)
+		} else {
+			s.logger.Printf("failed to create smart list: %v", err)
+			http.Error(w, "failed to create smart list", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&smartList)
+	if err != nil {
+		s.logger.Printf("failed to serialize smart list: %v", err)
+	}
+}
+
+func (s *server) handleGetUserSmartList(w http.ResponseWriter, r *http.Request) {
+	userId, smartListId, ok := s.parseSmartListIds(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	smartList, err := repo.GetSmartList(userId, smartListId)
+	if err != nil {
+		s.writeSmartListError(w, smartListId, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&smartList)
+	if err != nil {
+		s.logger.Printf("failed to serialize smart list: %v", err)
+	}
+}
+
+func (s *server) handleDeleteUserSmartList(w http.ResponseWriter, r *http.Request) {
+	userId, smartListId, ok := s.parseSmartListIds(w, r)
+	if !ok || !s.requireSelf(w, r, userId) {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err := repo.DeleteSmartList(userId, smartListId)
+	if err != nil {
+		s.writeSmartListError(w, smartListId, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetUserSmartListTitles lists a page of the titles currently matching a smart list.
+// It accepts the same `sort`, `limit` and `cursor` query parameters as handleGetTitles.
+func (s *server) handleGetUserSmartListTitles(w http.ResponseWriter, r *http.Request) {
+	userId, smartListId, ok := s.parseSmartListIds(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	page, err := parsePage(query)
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sort, err := parseTitleSort(query.Get("sort"), false)
+	if err != nil {
+		s.logger.Printf("invalid title sort: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	node, ok := s.smartListFilter(w, repo, userId, smartListId)
+	if !ok {
+		return
+	}
+	titles, next, err := repo.GetTitles(repository.TitleFilter{Expr: node}, sort, page)
+	if err != nil {
+		s.writeListError(w, "titles", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newListResponse(titles, next))
+	if err != nil {
+		s.logger.Printf("failed to serialize titles: %v", err)
+	}
+}
+
+// smartListFilter retrieves one of the user's smart lists and parses its filter, with `me` standing for the user.
+// It responds with an error and returns false if that isn't possible.
+func (s *server) smartListFilter(
+	w http.ResponseWriter,
+	repo *repository.Repository,
+	userId model.UserId,
+	smartListId model.Identifier,
+) (expr.Node, bool) {
+	smartList, err := repo.GetSmartList(userId, smartListId)
+	if err != nil {
+		s.writeSmartListError(w, smartListId, err)
+		return nil, false
+	}
+	owner, err := repo.GetUser(userId)
+	if err != nil {
+		s.logger.Printf("failed to retrieve user `%s`: %v", userId, err)
+		http.Error(w, "failed to retrieve smart list", http.StatusInternalServerError)
+		return nil, false
+	}
+	node, err := expr.Parse(smartList.Filter)
+	if err != nil {
+		s.logger.Printf("invalid filter for smart list `%s`: %v", smartListId, err)
+		http.Error(w, "failed to retrieve smart list", http.StatusInternalServerError)
+		return nil, false
+	}
+	userIds, err := repo.GetSmartListUsers(smartListId)
+	if err != nil {
+		s.logger.Printf("failed to retrieve users for smart list `%s`: %v", smartListId, err)
+		http.Error(w, "failed to retrieve smart list", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Users are named by their current username, whatever it was when the list was saved. Lists saved before
+	// users were recorded by ID fall back to looking them up by the username in the filter.
+	var stale string
+	expr.Walk(node, func(n expr.Node) {
+		userHas, ok := n.(*expr.UserHas)
+		if !ok || userHas.Username == expr.Me || stale != "" || err != nil {
+			return
+		}
+		var user *model.User
+		if userId, ok := userIds[userHas.Username]; ok {
+			user, err = repo.GetUser(userId)
+		} else {
+			user, err = repo.GetUserByUsername(userHas.Username)
+		}
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			stale, err = userHas.Username, nil
+		} else if err == nil {
+			userHas.Username = user.Username
+		}
+	})
+	switch {
+	case stale != "":
+		s.logger.Printf("smart list `%s` names unknown user `%s`", smartListId, stale)
+		http.Error(w, "smart list refers to user `"+stale+"`, who no longer exists or has been renamed", http.StatusConflict)
+		return nil, false
+	case err != nil:
+		s.logger.Printf("failed to resolve users for smart list `%s`: %v", smartListId, err)
+		http.Error(w, "failed to retrieve smart list", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if _, ok := s.resolveFilterUsers(w, repo, node, owner); !ok {
+		return nil, false
+	}
+	return node, true
+}
+
+func (s *server) parseSmartListIds(w http.ResponseWriter, r *http.Request) (userId model.UserId, smartListId model.Identifier, ok bool) {
+	userIdStr := r.PathValue("id")
+	userId, err := model.IdentifierFromString(userIdStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", userIdStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	smartListIdStr := r.PathValue("listId")
+	smartListId, err = model.IdentifierFromString(smartListIdStr)
+	if err != nil {
+		s.logger.Printf("invalid smart list id: `%s`", smartListIdStr)
+		http.Error(w, "invalid smart list id", http.StatusBadRequest)
+		return
+	}
+	return userId, smartListId, true
+}
+
+func (s *server) writeSmartListError(w http.ResponseWriter, smartListId model.Identifier, err error) {
+	if errors.Is(err, repository.ErrNoSuchSmartList) {
+		s.logger.Printf("smart list not found: `%s`", smartListId)
+		http.Error(w, "smart list not found", http.StatusNotFound)
+	} else {
+		s.logger.Printf("failed to process smart list `%s`: %v", smartListId, err)
+		http.Error(w, "failed to process smart list", http.StatusInternalServerError)
+	}
+}
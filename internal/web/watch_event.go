@@ -0,0 +1,170 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/repository"
+	"net/http"
+	"time"
+)
+
+// handleGetUserWatchEvents lists a page of the user's watch events, the most recent first. The `since` query
+// parameter, an RFC 3339 timestamp or a date, leaves out events before then.
+func (s *server) handleGetUserWatchEvents(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	page, err := parsePage(query)
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var since string
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		sinceTime, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			sinceTime, err = time.Parse(time.DateOnly, sinceStr)
+		}
+		if err != nil {
+			s.logger.Printf("invalid since: `%s`", sinceStr)
+			http.Error(w, "since must be an RFC 3339 timestamp or a date", http.StatusBadRequest)
+			return
+		}
+		since = sinceTime.UTC().Format(time.RFC3339)
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	if _, err = repo.GetUser(id); err != nil {
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			s.logger.Printf("user not found: `%s`", id)
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	events, next, err := repo.GetUserWatchEvents(id, since, page)
+	if err != nil {
+		s.writeListError(w, "watch events", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newListResponse(events, next))
+	if err != nil {
+		s.logger.Printf("failed to serialize watch events: %v", err)
+	}
+}
+
+// handlePostUserWatchEvents records that the user watched a title. Events are recorded as happening now and
+// coming from the user unless the client says otherwise.
+func (s *server) handlePostUserWatchEvents(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	var event *model.WatchEvent
+	err = json.NewDecoder(r.Body).Decode(&event)
+	if err != nil || event == nil {
+		s.logger.Printf("malformed watch event: %v", err)
+		http.Error(w, "malformed watch event", http.StatusBadRequest)
+		return
+	}
+	event.Id = model.NoId
+	event.UserId = id
+	if event.WatchedAt == "" {
+		event.WatchedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if event.Source == "" {
+		event.Source = model.WatchSourceManual
+	}
+	if err = event.Validate(); err != nil {
+		s.logger.Printf("malformed watch event: %v", err)
+		http.Error(w, "malformed watch event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Store every event in UTC so that they sort in the order they happened.
+	watchedAt, _ := time.Parse(time.RFC3339, event.WatchedAt)
+	event.WatchedAt = watchedAt.UTC().Format(time.RFC3339)
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.CreateWatchEvent(event)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNoSuchTitle):
+			s.logger.Printf("title not found: `%s`", event.TitleId)
+			http.Error(w, "title not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrNoSuchEpisode):
+			s.logger.Printf("episode `%s` not found in title `%s`", event.EpisodeId, event.TitleId)
+			http.Error(w, "episode not found", http.StatusNotFound)
+		default:
+			s.logger.Printf("failed to create watch event for user `%s`: %v", id, err)
+			http.Error(w, "failed to create watch event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&event)
+	if err != nil {
+		s.logger.Printf("failed to serialize watch event: %v", err)
+	}
+}
+
+func (s *server) handleDeleteUserWatchEvent(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+	eventIdStr := r.PathValue("eventId")
+	eventId, err := model.IdentifierFromString(eventIdStr)
+	if err != nil {
+		s.logger.Printf("invalid watch event id: `%s`", eventIdStr)
+		http.Error(w, "invalid watch event id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.DeleteWatchEvent(id, eventId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchWatchEvent) {
+			s.logger.Printf("watch event not found: `%s`", eventId)
+			http.Error(w, "watch event not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to delete watch event `%s`: %v", eventId, err)
+			http.Error(w, "failed to delete watch event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
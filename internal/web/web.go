@@ -3,12 +3,16 @@ package web
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/djcrock/fwip/internal/auth"
+	"github.com/djcrock/fwip/internal/expr"
 	"github.com/djcrock/fwip/internal/model"
+	"github.com/djcrock/fwip/internal/pick"
 	"github.com/djcrock/fwip/internal/repository"
 	"github.com/djcrock/fwip/internal/web/static"
+	"io"
 	"log"
 	"net/http"
-	"strconv"
 )
 
 type server struct {
@@ -30,61 +34,190 @@ func NewApp(
 	mux.Handle("GET /style.css", static.FileServer)
 	mux.Handle("GET /main.js", static.FileServer)
 	mux.HandleFunc("GET /", static.HandleIndex)
+	mux.HandleFunc("POST /login", server.handlePostLogin)
+	mux.HandleFunc("POST /logout", server.handlePostLogout)
 	mux.HandleFunc("GET /titles", server.handleGetTitles)
+	mux.HandleFunc("POST /titles", server.requireAdmin(model.ScopeCatalogWrite, server.handlePostTitles))
 	mux.HandleFunc("GET /titles/{id}", server.handleGetTitle)
+	mux.HandleFunc("PUT /titles/{id}", server.requireAdmin(model.ScopeCatalogWrite, server.handlePutTitle))
+	mux.HandleFunc("PATCH /titles/{id}", server.requireAdmin(model.ScopeCatalogWrite, server.handlePatchTitle))
+	mux.HandleFunc("DELETE /titles/{id}", server.requireAdmin(model.ScopeCatalogWrite, server.handleDeleteTitle))
+	mux.HandleFunc("GET /titles/{id}/services", server.handleGetTitleServices)
+	mux.HandleFunc("GET /titles/{id}/seasons", server.handleGetTitleSeasons)
+	mux.HandleFunc("PUT /titles/{id}/seasons/{number}", server.requireAdmin(model.ScopeCatalogWrite, server.handlePutTitleSeason))
+	mux.HandleFunc("DELETE /titles/{id}/seasons/{number}", server.requireAdmin(model.ScopeCatalogWrite, server.handleDeleteTitleSeason))
+	mux.HandleFunc("GET /titles/{id}/episodes", server.handleGetTitleEpisodes)
 	mux.HandleFunc("GET /services", server.handleGetServices)
 	mux.HandleFunc("GET /services/{id}", server.handleGetService)
+	mux.HandleFunc("GET /services/{id}/titles", server.handleGetServiceTitles)
+	mux.HandleFunc("PUT /services/{id}/titles/{titleId}", server.requireAdmin(model.ScopeCatalogWrite, server.handlePutServiceTitle))
+	mux.HandleFunc("DELETE /services/{id}/titles/{titleId}", server.requireAdmin(model.ScopeCatalogWrite, server.handleDeleteServiceTitle))
+	mux.HandleFunc("GET /people", server.handleGetPeople)
+	mux.HandleFunc("GET /people/{id}", server.handleGetPerson)
+	mux.HandleFunc("GET /people/{id}/titles", server.handleGetPersonTitles)
 	mux.HandleFunc("POST /users", server.handlePostUsers)
 	mux.HandleFunc("GET /users", server.handleGetUsers)
 	mux.HandleFunc("GET /users/{id}", server.handleGetUser)
-	mux.HandleFunc("POST /users/{id}/watch_history", server.handlePostUserWatchHistory)
-	mux.HandleFunc("GET /users/{id}/watch_history", server.handleGetUserWatchHistory)
+	mux.HandleFunc("PATCH /users/{id}", server.requireUser(model.ScopeAccountWrite, server.handlePatchUser))
+	mux.HandleFunc("PUT /users/{id}/role", server.requireAdmin(model.ScopeAccountWrite, server.handlePutUserRole))
+	mux.HandleFunc("POST /users/{id}/watch_history", server.requireUser(model.ScopeWatchHistoryWrite, server.handlePostUserWatchHistory))
+	mux.HandleFunc("GET /users/{id}/watch_history", server.requireUser(model.ScopeRead, server.handleGetUserWatchHistory))
+	mux.HandleFunc("GET /users/{id}/watch_events", server.requireUser(model.ScopeRead, server.handleGetUserWatchEvents))
+	mux.HandleFunc("POST /users/{id}/watch_events", server.requireUser(model.ScopeWatchHistoryWrite, server.handlePostUserWatchEvents))
+	mux.HandleFunc("DELETE /users/{id}/watch_events/{eventId}", server.requireUser(model.ScopeWatchHistoryWrite, server.handleDeleteUserWatchEvent))
+	mux.HandleFunc("PUT /users/{id}/watched_episodes/{episodeId}", server.requireUser(model.ScopeWatchHistoryWrite, server.handlePutUserWatchedEpisode))
+	mux.HandleFunc("DELETE /users/{id}/watched_episodes/{episodeId}", server.requireUser(model.ScopeWatchHistoryWrite, server.handleDeleteUserWatchedEpisode))
+	mux.HandleFunc("GET /users/{id}/next_up", server.requireUser(model.ScopeRead, server.handleGetUserNextUp))
+	mux.HandleFunc("GET /users/{id}/binge_plan", server.requireUser(model.ScopeRead, server.handleGetUserBingePlan))
+	mux.HandleFunc("GET /users/{id}/ratings", server.requireUser(model.ScopeRead, server.handleGetUserRatings))
+	mux.HandleFunc("PUT /users/{id}/ratings/{titleId}", server.requireUser(model.ScopeRatingsWrite, server.handlePutUserRating))
+	mux.HandleFunc("DELETE /users/{id}/ratings/{titleId}", server.requireUser(model.ScopeRatingsWrite, server.handleDeleteUserRating))
+	mux.HandleFunc("GET /users/{id}/tokens", server.requireUser(model.ScopeRead, server.handleGetUserApiTokens))
+	mux.HandleFunc("POST /users/{id}/tokens", server.requireUser(model.ScopeAccountWrite, server.handlePostUserApiTokens))
+	mux.HandleFunc("DELETE /users/{id}/tokens/{tokenId}", server.requireUser(model.ScopeAccountWrite, server.handleDeleteUserApiToken))
+	mux.HandleFunc("GET /users/{id}/smart_lists", server.requireUser(model.ScopeRead, server.handleGetUserSmartLists))
+	mux.HandleFunc("POST /users/{id}/smart_lists", server.requireUser(model.ScopeListsWrite, server.handlePostUserSmartLists))
+	mux.HandleFunc("GET /users/{id}/smart_lists/{listId}", server.requireUser(model.ScopeRead, server.handleGetUserSmartList))
+	mux.HandleFunc("DELETE /users/{id}/smart_lists/{listId}", server.requireUser(model.ScopeListsWrite, server.handleDeleteUserSmartList))
+	mux.HandleFunc("GET /users/{id}/smart_lists/{listId}/titles", server.requireUser(model.ScopeRead, server.handleGetUserSmartListTitles))
+	mux.HandleFunc("GET /users/{id}/lists", server.requireUser(model.ScopeRead, server.handleGetUserLists))
+	mux.HandleFunc("GET /users/{id}/share_links", server.requireUser(model.ScopeRead, server.handleGetUserShareLinks))
+	mux.HandleFunc("POST /users/{id}/share_links", server.requireUser(model.ScopeListsWrite, server.handlePostUserShareLinks))
+	mux.HandleFunc("DELETE /users/{id}/share_links/{linkId}", server.requireUser(model.ScopeListsWrite, server.handleDeleteUserShareLink))
+	mux.HandleFunc("GET /users/{id}/fwip", server.requireUser(model.ScopeRead, server.handleGetUserFwip))
+	mux.HandleFunc("POST /lists", server.requireUser(model.ScopeListsWrite, server.handlePostLists))
+	mux.HandleFunc("GET /lists/{id}", server.requireUser(model.ScopeRead, server.handleGetList))
+	mux.HandleFunc("DELETE /lists/{id}", server.requireUser(model.ScopeListsWrite, server.handleDeleteList))
+	mux.HandleFunc("PUT /lists/{id}/members/{userId}", server.requireUser(model.ScopeListsWrite, server.handlePutListMember))
+	mux.HandleFunc("DELETE /lists/{id}/members/{userId}", server.requireUser(model.ScopeListsWrite, server.handleDeleteListMember))
+	mux.HandleFunc("POST /lists/{id}/items", server.requireUser(model.ScopeListsWrite, server.handlePostListItems))
+	mux.HandleFunc("PATCH /lists/{id}/items", server.requireUser(model.ScopeListsWrite, server.handlePatchListItems))
+	mux.HandleFunc("DELETE /lists/{id}/items/{titleId}", server.requireUser(model.ScopeListsWrite, server.handleDeleteListItem))
+	mux.HandleFunc("GET /share/{token}", server.handleGetShare)
+	mux.HandleFunc("GET /fwip/group", server.requireUser(model.ScopeRead, server.handleGetGroupFwip))
+	mux.HandleFunc("POST /change_requests", server.requireUser(model.ScopeChangeRequestsWrite, server.handlePostChangeRequests))
+	mux.HandleFunc("GET /change_requests", server.requireAdmin(model.ScopeRead, server.handleGetChangeRequests))
+	mux.HandleFunc("GET /change_requests/{id}", server.requireUser(model.ScopeRead, server.handleGetChangeRequest))
+	mux.HandleFunc("PUT /change_requests/{id}", server.requireAdmin(model.ScopeChangeRequestsWrite, server.handlePutChangeRequest))
+	mux.HandleFunc("POST /change_requests/{id}/approve", server.requireAdmin(model.ScopeChangeRequestsWrite, server.handlePostChangeRequestApprove))
+	mux.HandleFunc("POST /change_requests/{id}/reject", server.requireAdmin(model.ScopeChangeRequestsWrite, server.handlePostChangeRequestReject))
 
 	// TODO: add a "-dev" flag to control this
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.Header().Add("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Add("Access-Control-Allow-Headers", "Authorization, Content-Type")
 		//w.Header().Add("Access-Control-Allow-Credentials", "true")
-		mux.ServeHTTP(w, r)
+		if r, ok := server.authenticate(w, r); ok {
+			mux.ServeHTTP(w, r)
+		}
 	})
 }
 
+// handleGetTitles lists a page of titles. They can be filtered with these query parameters:
+//   - `service` for titles currently available on the service, given any number of times
+//   - `genre` for titles with the genre
+//   - `q` to search title names
+//   - `type`, `year_min`, `year_max` and `runtime_max`
+//   - `filter` for titles matching an expression, as described in package expr
+//
+// The `sort` query parameter orders them by `name`, `year`, `release_date` or `runtime`, with a leading `-`
+// for descending order. Searches are ordered by relevance by default, and other lists by name.
 func (s *server) handleGetTitles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, err := parsePage(query)
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseTitleFilter(query)
+	if err != nil {
+		s.logger.Printf("invalid title filter: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sort, err := parseTitleSort(query.Get("sort"), filter.Query != "")
+	if err != nil {
+		s.logger.Printf("invalid title sort: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	repo := s.repoPool.GetRepository(r.Context())
 	defer s.repoPool.PutRepository(repo)
 
-	var titles []*model.Title
-	var err error
-	serviceIdStr := r.URL.Query().Get("service")
-	if serviceIdStr != "" {
-		serviceId, err := strconv.ParseInt(serviceIdStr, 10, 64)
-		if err != nil {
-			s.logger.Printf("invalid service id: %v", err)
-			http.Error(w, "invalid service id", http.StatusInternalServerError)
+	if filter.Expr != nil {
+		if _, ok := s.resolveFilterUsers(w, repo, filter.Expr, currentUser(r)); !ok {
+			return
 		}
-		titles, err = repo.GetTitlesByService(serviceId)
-	} else {
-		titles, err = repo.GetTitles()
 	}
-
+	titles, next, err := repo.GetTitles(filter, sort, page)
 	if err != nil {
-		s.logger.Printf("failed to retrieve titles: %v", err)
-		http.Error(w, "failed to retrieve titles", http.StatusInternalServerError)
+		s.writeListError(w, "titles", err)
+		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(&titles)
+	err = json.NewEncoder(w).Encode(newListResponse(titles, next))
 	if err != nil {
 		s.logger.Printf("failed to serialize titles: %v", err)
 	}
 }
 
+// resolveFilterUsers replaces `me` in a filter with the username of the given user, who may be nil if nobody is
+// logged in, and returns the IDs of the other users the filter names, by username. It responds 400 and returns
+// false if the filter names a user who doesn't exist, or names anybody when nobody is logged in.
+func (s *server) resolveFilterUsers(
+	w http.ResponseWriter,
+	repo *repository.Repository,
+	node expr.Node,
+	me *model.User,
+) (map[string]model.UserId, bool) {
+	userIds := make(map[string]model.UserId)
+	var invalid, err error
+	expr.Walk(node, func(n expr.Node) {
+		userHas, ok := n.(*expr.UserHas)
+		if !ok || invalid != nil || err != nil {
+			return
+		}
+		if me == nil {
+			// What users have watched is only visible to those logged in, or through share links.
+			invalid = fmt.Errorf("log in to filter on `%s`", userHas.Username)
+			return
+		}
+		if userHas.Username == expr.Me {
+			userHas.Username = me.Username
+			return
+		}
+		var user *model.User
+		user, err = repo.GetUserByUsername(userHas.Username)
+		if errors.Is(err, repository.ErrNoSuchUser) {
+			invalid = fmt.Errorf("unknown user `%s`", userHas.Username)
+			err = nil
+		} else if err == nil {
+			userIds[userHas.Username] = user.Id
+		}
+	})
+	switch {
+	case invalid != nil:
+		s.logger.Printf("invalid filter: %v", invalid)
+		http.Error(w, "invalid filter: "+invalid.Error(), http.StatusBadRequest)
+		return nil, false
+	case err != nil:
+		s.logger.Printf("failed to resolve users in filter: %v", err)
+		http.Error(w, "failed to retrieve titles", http.StatusInternalServerError)
+		return nil, false
+	}
+	return userIds, true
+}
+
 func (s *server) handleGetTitle(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := model.IdentifierFromString(idStr)
 	if err != nil {
-		s.logger.Printf("invalid id: %v", err)
-		http.Error(w, "invalid id", http.StatusInternalServerError)
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
 	}
 
 	repo := s.repoPool.GetRepository(r.Context())
@@ -93,14 +226,94 @@ func (s *server) handleGetTitle(w http.ResponseWriter, r *http.Request) {
 	title, err := repo.GetTitle(id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNoSuchTitle) {
-			s.logger.Printf("title not found: `%d`", id)
+			s.logger.Printf("title not found: `%s`", id)
 			http.Error(w, "title not found", http.StatusNotFound)
 		} else {
-			s.logger.Printf("failed to retrieve title `%d`: %v", id, err)
+			s.logger.Printf("failed to retrieve title `%s`: %v", id, err)
 			http.Error(w, "failed to retrieve title", http.StatusInternalServerError)
 		}
 		return
 	}
+	title.Genres, err = repo.GetTitleGenres(id)
+	if err == nil {
+		title.Credits, err = repo.GetTitleCredits(id)
+	}
+	if err != nil {
+		s.logger.Printf("failed to retrieve metadata for title `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve title", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&title)
+	if err != nil {
+		s.logger.Printf("failed to serialize title: %v", err)
+	}
+}
+
+func (s *server) handlePostTitles(w http.ResponseWriter, r *http.Request) {
+	var title *model.Title
+	err := json.NewDecoder(r.Body).Decode(&title)
+	if err != nil || title == nil {
+		s.logger.Printf("malformed title: %v", err)
+		http.Error(w, "malformed title", http.StatusBadRequest)
+		return
+	}
+	title.Id = model.NoId
+	if err = title.Validate(); err != nil {
+		s.logger.Printf("malformed title: %v", err)
+		http.Error(w, "malformed title: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.PutTitle(title)
+	if err != nil {
+		s.writeTitleWriteError(w, title, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(&title)
+	if err != nil {
+		s.logger.Printf("failed to serialize title: %v", err)
+	}
+}
+
+func (s *server) handlePutTitle(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil || id == model.NoId {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var title *model.Title
+	err = json.NewDecoder(r.Body).Decode(&title)
+	if err != nil || title == nil {
+		s.logger.Printf("malformed title: %v", err)
+		http.Error(w, "malformed title", http.StatusBadRequest)
+		return
+	}
+	title.Id = id
+	if err = title.Validate(); err != nil {
+		s.logger.Printf("malformed title: %v", err)
+		http.Error(w, "malformed title: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.PutTitle(title)
+	if err != nil {
+		s.writeTitleWriteError(w, title, err)
+		return
+	}
 
 	w.Header().Add("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(&title)
@@ -109,6 +322,118 @@ func (s *server) handleGetTitle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlePatchTitle applies a partial update: only the fields present in the request body are changed.
+func (s *server) handlePatchTitle(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	var title *model.Title
+	err = inTransaction(repo, func() error {
+		title, err = repo.GetTitle(id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNoSuchTitle) {
+				s.logger.Printf("title not found: `%s`", id)
+				http.Error(w, "title not found", http.StatusNotFound)
+			} else {
+				s.logger.Printf("failed to retrieve title `%s`: %v", id, err)
+				http.Error(w, "failed to retrieve title", http.StatusInternalServerError)
+			}
+			return err
+		}
+
+		err = json.NewDecoder(r.Body).Decode(title)
+		if err != nil {
+			s.logger.Printf("malformed title: %v", err)
+			http.Error(w, "malformed title", http.StatusBadRequest)
+			return err
+		}
+		title.Id = id
+		if err = title.Validate(); err != nil {
+			s.logger.Printf("malformed title: %v", err)
+			http.Error(w, "malformed title: "+err.Error(), http.StatusBadRequest)
+			return err
+		}
+
+		_, err = repo.PutTitle(title)
+		if err != nil {
+			s.writeTitleWriteError(w, title, err)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&title)
+	if err != nil {
+		s.logger.Printf("failed to serialize title: %v", err)
+	}
+}
+
+func (s *server) handleDeleteTitle(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.DeleteTitle(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchTitle) {
+			s.logger.Printf("title not found: `%s`", id)
+			http.Error(w, "title not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to delete title `%s`: %v", id, err)
+			http.Error(w, "failed to delete title", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inTransaction runs fn in a transaction, which is rolled back if fn returns an error. Handlers respond
+// once it has returned, so that a failure to respond can't roll back work that has already been done.
+func inTransaction(repo *repository.Repository, fn func() error) (err error) {
+	defer repo.Transact()(&err)
+	return fn()
+}
+
+// writeTitleWriteError responds to a failed attempt to create or update a title.
+func (s *server) writeTitleWriteError(w http.ResponseWriter, title *model.Title, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNoSuchTitle):
+		s.logger.Printf("title not found: `%s`", title.Id)
+		http.Error(w, "title not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrDuplicateTitle):
+		s.logger.Printf("duplicate imdb id: `%s`", title.ImdbId)
+		http.Error(w, "a title with that imdb_id already exists", http.StatusConflict)
+	case errors.Is(err, repository.ErrNoSuchPerson):
+		s.logger.Printf("credited person not found for title `%s`", title.Id)
+		http.Error(w, "credited person not found", http.StatusBadRequest)
+	case errors.Is(err, repository.ErrDuplicateCredit):
+		s.logger.Printf("duplicate credit for title `%s`", title.Id)
+		http.Error(w, "malformed title: "+err.Error(), http.StatusBadRequest)
+	default:
+		s.logger.Printf("failed to save title: %v", err)
+		http.Error(w, "failed to save title", http.StatusInternalServerError)
+	}
+}
+
 func (s *server) handleGetServices(w http.ResponseWriter, r *http.Request) {
 	repo := s.repoPool.GetRepository(r.Context())
 	defer s.repoPool.PutRepository(repo)
@@ -128,10 +453,11 @@ func (s *server) handleGetServices(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) handleGetService(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := model.IdentifierFromString(idStr)
 	if err != nil {
-		s.logger.Printf("invalid id: %v", err)
-		http.Error(w, "invalid id", http.StatusInternalServerError)
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
 	}
 
 	repo := s.repoPool.GetRepository(r.Context())
@@ -140,10 +466,10 @@ func (s *server) handleGetService(w http.ResponseWriter, r *http.Request) {
 	service, err := repo.GetService(id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNoSuchService) {
-			s.logger.Printf("service not found: `%d`", id)
+			s.logger.Printf("service not found: `%s`", id)
 			http.Error(w, "service not found", http.StatusNotFound)
 		} else {
-			s.logger.Printf("failed to retrieve service `%d`: %v", id, err)
+			s.logger.Printf("failed to retrieve service `%s`: %v", id, err)
 			http.Error(w, "failed to retrieve service", http.StatusInternalServerError)
 		}
 		return
@@ -156,47 +482,281 @@ func (s *server) handleGetService(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *server) handleGetTitleServices(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.GetTitle(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchTitle) {
+			s.logger.Printf("title not found: `%s`", id)
+			http.Error(w, "title not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve title `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve title", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	services, err := repo.GetServicesByTitle(id)
+	if err != nil {
+		s.logger.Printf("failed to retrieve services for title `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve services", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&services)
+	if err != nil {
+		s.logger.Printf("failed to serialize services: %v", err)
+	}
+}
+
+// handleGetServiceTitles lists the titles currently on a service. The `leaving_within` and `added_within`
+// query parameters (e.g. `14d` or `2w`) narrow the list to titles leaving or arriving soon.
+func (s *server) handleGetServiceTitles(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var filter repository.ServiceTitleFilter
+	if leavingWithin := r.URL.Query().Get("leaving_within"); leavingWithin != "" {
+		filter.LeavingWithinDays, err = parseDays(leavingWithin)
+		if err != nil {
+			s.logger.Printf("invalid leaving_within: %v", err)
+			http.Error(w, "invalid leaving_within: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if addedWithin := r.URL.Query().Get("added_within"); addedWithin != "" {
+		filter.AddedWithinDays, err = parseDays(addedWithin)
+		if err != nil {
+			s.logger.Printf("invalid added_within: %v", err)
+			http.Error(w, "invalid added_within: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	_, err = repo.GetService(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchService) {
+			s.logger.Printf("service not found: `%s`", id)
+			http.Error(w, "service not found", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to retrieve service `%s`: %v", id, err)
+			http.Error(w, "failed to retrieve service", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	serviceTitles, err := repo.GetServiceTitles(id, filter)
+	if err != nil {
+		s.logger.Printf("failed to retrieve titles for service `%s`: %v", id, err)
+		http.Error(w, "failed to retrieve titles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&serviceTitles)
+	if err != nil {
+		s.logger.Printf("failed to serialize service titles: %v", err)
+	}
+}
+
+func (s *server) handlePutServiceTitle(w http.ResponseWriter, r *http.Request) {
+	serviceId, titleId, ok := s.parseServiceTitleIds(w, r)
+	if !ok {
+		return
+	}
+
+	// The availability window is optional, so an empty body is allowed.
+	serviceTitle := &model.ServiceTitle{}
+	err := json.NewDecoder(r.Body).Decode(serviceTitle)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.logger.Printf("malformed service title: %v", err)
+		http.Error(w, "malformed service title", http.StatusBadRequest)
+		return
+	}
+	serviceTitle.ServiceId = serviceId
+	serviceTitle.TitleId = titleId
+	if err = serviceTitle.Validate(); err != nil {
+		s.logger.Printf("malformed service title: %v", err)
+		http.Error(w, "malformed service title: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err = repo.PutServiceTitle(serviceTitle)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNoSuchService):
+			s.logger.Printf("service not found: `%s`", serviceId)
+			http.Error(w, "service not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrNoSuchTitle):
+			s.logger.Printf("title not found: `%s`", titleId)
+			http.Error(w, "title not found", http.StatusNotFound)
+		default:
+			s.logger.Printf("failed to add title `%s` to service `%s`: %v", titleId, serviceId, err)
+			http.Error(w, "failed to add title to service", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleDeleteServiceTitle(w http.ResponseWriter, r *http.Request) {
+	serviceId, titleId, ok := s.parseServiceTitleIds(w, r)
+	if !ok {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	err := repo.DeleteServiceTitle(serviceId, titleId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoSuchServiceTitle) {
+			s.logger.Printf("title `%s` not found on service `%s`", titleId, serviceId)
+			http.Error(w, "title not found on service", http.StatusNotFound)
+		} else {
+			s.logger.Printf("failed to remove title `%s` from service `%s`: %v", titleId, serviceId, err)
+			http.Error(w, "failed to remove title from service", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseServiceTitleIds reads the service and title IDs from the path, responding with an error if either is invalid.
+func (s *server) parseServiceTitleIds(w http.ResponseWriter, r *http.Request) (serviceId model.ServiceId, titleId model.TitleId, ok bool) {
+	serviceIdStr := r.PathValue("id")
+	serviceId, err := model.IdentifierFromString(serviceIdStr)
+	if err != nil {
+		s.logger.Printf("invalid service id: `%s`", serviceIdStr)
+		http.Error(w, "invalid service id", http.StatusBadRequest)
+		return
+	}
+	titleIdStr := r.PathValue("titleId")
+	titleId, err = model.IdentifierFromString(titleIdStr)
+	if err != nil {
+		s.logger.Printf("invalid title id: `%s`", titleIdStr)
+		http.Error(w, "invalid title id", http.StatusBadRequest)
+		return
+	}
+	return serviceId, titleId, true
+}
+
 func (s *server) handlePostUsers(w http.ResponseWriter, r *http.Request) {
-	var user *model.User
-	err := json.NewDecoder(r.Body).Decode(&user)
+	var body struct {
+		model.User
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		s.logger.Printf("malformed user: %v", err)
 		http.Error(w, "malformed user", http.StatusBadRequest)
 		return
 	}
+	user := &body.User
+	user.Id = model.NoId
+	user.Role = model.RoleMember
 	if user.Username == "" {
 		s.logger.Printf("malformed user: missing username")
 		http.Error(w, "malformed user: missing username", http.StatusBadRequest)
 		return
 	}
+	if user.PickStrategy != "" {
+		if _, err = pick.Get(user.PickStrategy); err != nil {
+			s.logger.Printf("malformed user: %v", err)
+			http.Error(w, "malformed user: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(body.Password) < auth.MinPasswordLength {
+		s.logger.Printf("malformed user: password too short")
+		http.Error(w, "malformed user: password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+	passwordHash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		s.logger.Printf("failed to hash password: %v", err)
+		http.Error(w, "failed to create user", http.StatusInternalServerError)
+		return
+	}
 
 	repo := s.repoPool.GetRepository(r.Context())
 	defer s.repoPool.PutRepository(repo)
 
-	_, err = repo.PutUser(user)
+	err = inTransaction(repo, func() error {
+		_, err = repo.PutUser(user)
+		if err != nil {
+			if errors.Is(err, repository.ErrDuplicateUser) {
+				s.logger.Printf("duplicate username: `%s`", user.Username)
+				http.Error(w, "a user with that username already exists", http.StatusConflict)
+			} else {
+				s.logger.Printf("failed to create user: %v", err)
+				http.Error(w, "failed to create user", http.StatusInternalServerError)
+			}
+			return err
+		}
+		err = repo.SetUserPassword(user.Id, passwordHash)
+		if err != nil {
+			s.logger.Printf("failed to set password for user `%s`: %v", user.Id, err)
+			http.Error(w, "failed to create user", http.StatusInternalServerError)
+		}
+		return err
+	})
 	if err != nil {
-		s.logger.Printf("failed to create user: %v", err)
-		http.Error(w, "failed to create user", http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(&user)
 	if err != nil {
 		s.logger.Printf("failed to serialize user: %v", err)
 	}
 }
 
+// handleGetUsers lists a page of users in order of username.
 func (s *server) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	repo := s.repoPool.GetRepository(r.Context())
 	defer s.repoPool.PutRepository(repo)
 
-	users, err := repo.GetUsers()
+	users, next, err := repo.GetUsers(page)
 	if err != nil {
-		s.logger.Printf("failed to retrieve users: %v", err)
-		http.Error(w, "failed to retrieve users", http.StatusInternalServerError)
+		s.writeListError(w, "users", err)
+		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(&users)
+	err = json.NewEncoder(w).Encode(newListResponse(users, next))
 	if err != nil {
 		s.logger.Printf("failed to serialize users: %v", err)
 	}
@@ -204,10 +764,11 @@ func (s *server) handleGetUsers(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) handleGetUser(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := model.IdentifierFromString(idStr)
 	if err != nil {
-		s.logger.Printf("invalid id: %v", err)
-		http.Error(w, "invalid id", http.StatusInternalServerError)
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
 	}
 
 	repo := s.repoPool.GetRepository(r.Context())
@@ -216,10 +777,10 @@ func (s *server) handleGetUser(w http.ResponseWriter, r *http.Request) {
 	user, err := repo.GetUser(id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNoSuchUser) {
-			s.logger.Printf("user not found: `%d`", id)
+			s.logger.Printf("user not found: `%s`", id)
 			http.Error(w, "user not found", http.StatusNotFound)
 		} else {
-			s.logger.Printf("failed to retrieve user `%d`: %v", id, err)
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
 			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
 		}
 		return
@@ -232,14 +793,176 @@ func (s *server) handleGetUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlePatchUser applies a partial update: only the fields present in the request body are changed.
+func (s *server) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	var user *model.User
+	err = inTransaction(repo, func() error {
+		user, err = repo.GetUser(id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNoSuchUser) {
+				s.logger.Printf("user not found: `%s`", id)
+				http.Error(w, "user not found", http.StatusNotFound)
+			} else {
+				s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+				http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+			}
+			return err
+		}
+
+		// Roles are changed through handlePutUserRole.
+		role := user.Role
+		err = json.NewDecoder(r.Body).Decode(user)
+		if err != nil {
+			s.logger.Printf("malformed user: %v", err)
+			http.Error(w, "malformed user", http.StatusBadRequest)
+			return err
+		}
+		user.Id = id
+		user.Role = role
+		if user.Username == "" {
+			err = errors.New("missing username")
+			s.logger.Printf("malformed user: %v", err)
+			http.Error(w, "malformed user: missing username", http.StatusBadRequest)
+			return err
+		}
+		if user.PickStrategy != "" {
+			if _, err = pick.Get(user.PickStrategy); err != nil {
+				s.logger.Printf("malformed user: %v", err)
+				http.Error(w, "malformed user: "+err.Error(), http.StatusBadRequest)
+				return err
+			}
+		}
+
+		_, err = repo.PutUser(user)
+		if err != nil {
+			if errors.Is(err, repository.ErrDuplicateUser) {
+				s.logger.Printf("duplicate username: `%s`", user.Username)
+				http.Error(w, "a user with that username already exists", http.StatusConflict)
+			} else {
+				s.logger.Printf("failed to update user `%s`: %v", id, err)
+				http.Error(w, "failed to update user", http.StatusInternalServerError)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&user)
+	if err != nil {
+		s.logger.Printf("failed to serialize user: %v", err)
+	}
+}
+
+// handlePutUserRole lets an admin promote or demote a user. The last admin can't be demoted,
+// since nobody would be left to promote a replacement.
+func (s *server) handlePutUserRole(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || !model.IsValidRole(body.Role) {
+		s.logger.Printf("malformed role: %v", err)
+		http.Error(w, "role must be `admin` or `member`", http.StatusBadRequest)
+		return
+	}
+
+	repo := s.repoPool.GetRepository(r.Context())
+	defer s.repoPool.PutRepository(repo)
+
+	var user *model.User
+	err = inTransaction(repo, func() error {
+		user, err = repo.GetUser(id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNoSuchUser) {
+				s.logger.Printf("user not found: `%s`", id)
+				http.Error(w, "user not found", http.StatusNotFound)
+			} else {
+				s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
+				http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
+			}
+			return err
+		}
+
+		if user.IsAdmin() && body.Role != model.RoleAdmin {
+			var admins int64
+			admins, err = repo.CountUsersWithRole(model.RoleAdmin)
+			if err != nil {
+				s.logger.Printf("failed to count admins: %v", err)
+				http.Error(w, "failed to update role", http.StatusInternalServerError)
+				return err
+			}
+			if admins <= 1 {
+				err = errors.New("cannot demote the last admin")
+				s.logger.Printf("refusing to demote user `%s`: %v", id, err)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return err
+			}
+		}
+
+		user.Role = body.Role
+		_, err = repo.PutUser(user)
+		if err != nil {
+			s.logger.Printf("failed to update role for user `%s`: %v", id, err)
+			http.Error(w, "failed to update role", http.StatusInternalServerError)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&user)
+	if err != nil {
+		s.logger.Printf("failed to serialize user: %v", err)
+	}
+}
+
 func (s *server) handlePostUserWatchHistory(w http.ResponseWriter, r *http.Request) {
-	var watchHistory *model.WatchHistory
-	err := json.NewDecoder(r.Body).Decode(&watchHistory)
+	idStr := r.PathValue("id")
+	id, err := model.IdentifierFromString(idStr)
 	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !s.requireSelf(w, r, id) {
+		return
+	}
+
+	var watchHistory *model.WatchHistory
+	err = json.NewDecoder(r.Body).Decode(&watchHistory)
+	if err != nil || watchHistory == nil {
 		s.logger.Printf("malformed watch history: %v", err)
 		http.Error(w, "malformed watch history", http.StatusBadRequest)
 		return
 	}
+	watchHistory.UserId = id
 
 	repo := s.repoPool.GetRepository(r.Context())
 	defer s.repoPool.PutRepository(repo)
@@ -248,6 +971,7 @@ func (s *server) handlePostUserWatchHistory(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		s.logger.Printf("failed to create watch history: %v", err)
 		http.Error(w, "failed to create watch history", http.StatusInternalServerError)
+		return
 	}
 
 	err = json.NewEncoder(w).Encode(&watchHistory)
@@ -256,12 +980,20 @@ func (s *server) handlePostUserWatchHistory(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// handleGetUserWatchHistory lists a page of the user's watch history in order of title ID.
 func (s *server) handleGetUserWatchHistory(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := model.IdentifierFromString(idStr)
+	if err != nil {
+		s.logger.Printf("invalid id: `%s`", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r.URL.Query())
 	if err != nil {
-		s.logger.Printf("invalid id: %v", err)
-		http.Error(w, "invalid id", http.StatusInternalServerError)
+		s.logger.Printf("invalid page: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	repo := s.repoPool.GetRepository(r.Context())
@@ -270,23 +1002,23 @@ func (s *server) handleGetUserWatchHistory(w http.ResponseWriter, r *http.Reques
 	user, err := repo.GetUser(id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNoSuchUser) {
-			s.logger.Printf("user not found: `%d`", id)
+			s.logger.Printf("user not found: `%s`", id)
 			http.Error(w, "user not found", http.StatusNotFound)
 		} else {
-			s.logger.Printf("failed to retrieve user `%d`: %v", id, err)
+			s.logger.Printf("failed to retrieve user `%s`: %v", id, err)
 			http.Error(w, "failed to retrieve user", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	watchHistory, err := repo.GetUserWatchHistory(user.Id)
+	watchHistory, next, err := repo.GetUserWatchHistory(user.Id, page)
 	if err != nil {
-		s.logger.Printf("failed to retrieve watch history: %v", err)
-		http.Error(w, "failed to retrieve watch history", http.StatusInternalServerError)
+		s.writeListError(w, "watch history", err)
+		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(&watchHistory)
+	err = json.NewEncoder(w).Encode(newListResponse(watchHistory, next))
 	if err != nil {
 		s.logger.Printf("failed to serialize watch history: %v", err)
 	}